@@ -5,28 +5,46 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"sync/atomic"
 
-	"github.com/newrelic/go-agent/v3/integrations/nrhttprouter"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/streamdal/go-svc-template/clog"
 	"github.com/streamdal/go-svc-template/config"
 	"github.com/streamdal/go-svc-template/deps"
+	"github.com/streamdal/go-svc-template/ratelimit"
 )
 
 type API struct {
-	config  *config.Config
-	deps    *deps.Dependencies
-	log     clog.ICustomLog
-	version string
+	config *config.Config
+	deps   *deps.Dependencies
+	auth   *authenticator
+
+	// adminAuth is used by the admin listener
+	adminAuth *authenticator
+
+	// rateLimits holds nil while rate limiting is disabled; limiter is
+	// shared by every (reloaded) rateLimits
+	rateLimits atomic.Pointer[rateLimits]
+	limiter    *ratelimit.Limiter
+
+	// tailEnabled can be toggled by a config reload
+	tailEnabled atomic.Bool
+
+	// grpcServices are registered on the gRPC server (see RegisterGRPC)
+	grpcServices []GRPCRegisterFunc
+	log          clog.ICustomLog
+	version      string
 }
 
 type ResponseJSON struct {
 	Status  int               `json:"status"`
 	Message string            `json:"message"`
 	Values  map[string]string `json:"values,omitempty"`
-	Errors  string            `json:"errors,omitempty"`
+
+	// Deprecated: errors are rendered as problem details (see WriteProblem)
+	Errors string `json:"errors,omitempty"`
 }
 
 func New(cfg *config.Config, d *deps.Dependencies, version string) (*API, error) {
@@ -38,30 +56,175 @@ func New(cfg *config.Config, d *deps.Dependencies, version string) (*API, error)
 		return nil, errors.New("deps cannot be nil")
 	}
 
-	return &API{
-		config:  cfg,
-		deps:    d,
-		version: version,
-		log:     d.Log.With(zap.String("pkg", "api")),
-	}, nil
+	if cfg.AdminListenAddress != "" && cfg.AdminListenAddress == cfg.APIListenAddress {
+		return nil, errors.New("admin listen address must differ from API listen address")
+	}
+
+	auth, err := newAuthenticator(&cfg.Auth)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to setup authentication")
+	}
+
+	// The admin listener falls back to the API listener's credentials if it
+	// has none of its own
+	adminAuth := auth
+
+	if !cfg.AdminListenerAuth.Empty() {
+		adminAuth, err = newAuthenticator(&cfg.AdminListenerAuth)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to setup admin listener authentication")
+		}
+	}
+
+	a := &API{
+		config:    cfg,
+		deps:      d,
+		auth:      auth,
+		adminAuth: adminAuth,
+		version:   version,
+		log:       d.Log.With(zap.String("pkg", "api")),
+	}
+
+	// Settings that can be reloaded are read from the latest config
+	current := cfg
+
+	if d.Reloader != nil {
+		current = d.Reloader.Current()
+	}
+
+	rl, err := a.newRateLimits(current)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to setup rate limiting")
+	}
+
+	a.rateLimits.Store(rl)
+	a.tailEnabled.Store(current.TailEnabled)
+
+	if d.Reloader != nil {
+		d.Reloader.Subscribe("api", a.reloadConfig)
+	}
+
+	return a, nil
 }
 
+// Run starts the API listener and, if configured, the admin and gRPC
+// listeners. It blocks until one of them fails.
 func (a *API) Run() error {
-	logger := a.log.With(zap.String("method", "Run"))
+	servers := a.servers()
+	errCh := make(chan error, len(servers)+1)
+
+	for _, srv := range servers {
+		go func(srv *server) {
+			errCh <- srv.run()
+		}(srv)
+	}
 
-	router := nrhttprouter.New(a.deps.NewRelicApp)
+	if a.config.GRPCListenAddress != "" {
+		go func() {
+			errCh <- a.runGRPC()
+		}()
+	}
+
+	return <-errCh
+}
 
-	router.HandlerFunc("GET", "/health-check", a.healthCheckHandler)
-	router.HandlerFunc("GET", "/version", a.versionHandler)
+// servers sets up the routes for every listener. Without a separate admin
+// listener, all routes are served on the API listener.
+func (a *API) servers() []*server {
+	api := a.newServer(deps.ListenerAPI, a.config.APIListenAddress, a.auth)
+
+	a.registerPublicRoutes(api)
+
+	if a.config.AdminListenAddress == "" {
+		a.registerAdminRoutes(api)
+		return []*server{api}
+	}
+
+	admin := a.newServer(deps.ListenerAdmin, a.config.AdminListenAddress, a.adminAuth)
+
+	a.registerAdminRoutes(admin)
+
+	return []*server{api, admin}
+}
+
+// registerPublicRoutes registers routes that are always served on the API listener
+func (a *API) registerPublicRoutes(s *server) {
+	a.handle(s, http.MethodGet, "/health-check", HandlerFunc(a.healthCheckHandler))
+	a.handle(s, http.MethodGet, "/version", HandlerFunc(a.versionHandler))
+
+	if a.deps.PublisherBackend != nil {
+		a.handleRole(s, RoleAdmin, http.MethodPost, "/v1/publish", HandlerFunc(a.publishHandler))
+	}
+}
+
+// registerAdminRoutes registers probe, metrics, admin and debug routes
+func (a *API) registerAdminRoutes(s *server) {
+	a.handle(s, http.MethodGet, "/health", HandlerFunc(a.healthHandler))
+	a.handle(s, http.MethodGet, "/live", http.HandlerFunc(a.liveHandler))
+	a.handle(s, http.MethodGet, "/ready", http.HandlerFunc(a.readyHandler))
+	a.handle(s, http.MethodGet, "/startup", http.HandlerFunc(a.startupHandler))
+	a.handle(s, http.MethodGet, "/metrics", a.deps.Metrics.Handler())
+
+	if s.name != deps.ListenerAPI {
+		a.handle(s, http.MethodGet, "/version", HandlerFunc(a.versionHandler))
+	}
+
+	// Operator routes are read-only, admin routes can modify state. Routes are
+	// only registered if at least one credential grants the required role.
+	a.handleRole(s, RoleOperator, http.MethodGet, "/admin/cache/stats", HandlerFunc(a.cacheStatsHandler))
+	a.handleRole(s, RoleOperator, http.MethodGet, "/admin/cache/keys", HandlerFunc(a.cacheKeysHandler))
+	a.handleRole(s, RoleOperator, http.MethodGet, "/admin/cache/items/*key", HandlerFunc(a.cacheGetHandler))
+	a.handleRole(s, RoleAdmin, http.MethodPut, "/admin/cache/items/*key", HandlerFunc(a.cacheSetHandler))
+	a.handleRole(s, RoleAdmin, http.MethodDelete, "/admin/cache/items/*key", HandlerFunc(a.cacheDeleteHandler))
+
+	a.handleRole(s, RoleOperator, http.MethodGet, "/admin/config", HandlerFunc(a.configHandler))
+	a.handleRole(s, RoleOperator, http.MethodGet, "/admin/proc/status", HandlerFunc(a.procStatusHandler))
+
+	// Registered even if disabled since the tail can be enabled by a reload
+	a.handleRole(s, RoleAdmin, http.MethodGet, "/admin/proc/tail", HandlerFunc(a.tailHandler))
+
+	if a.deps.LogLevels != nil {
+		a.handleRole(s, RoleOperator, http.MethodGet, "/admin/log/levels", HandlerFunc(a.logLevelsHandler))
+		a.handleRole(s, RoleAdmin, http.MethodPut, "/admin/log/levels", HandlerFunc(a.logLevelSetHandler))
+		a.handleRole(s, RoleAdmin, http.MethodDelete, "/admin/log/levels", HandlerFunc(a.logLevelResetHandler))
+	}
 
 	// Maybe enable profiling
 	if a.config.EnablePprof {
-		router.Handler(http.MethodGet, "/debug/pprof/*item", http.DefaultServeMux)
+		role, _ := ParseRole(a.config.PprofRole)
+
+		if !s.auth.enabled(role) {
+			a.log.Warn("pprof is enabled but no credentials grant the required role; not serving pprof",
+				zap.String("listener", s.name), zap.String("role", role.String()))
+		}
+
+		a.handleRole(s, role, http.MethodGet, "/debug/pprof/*item", http.DefaultServeMux)
 	}
+}
+
+// handle registers a route on the router, instrumented via deps.Telemetry
+// and deps.Metrics and with the route's rate and body limits
+func (a *API) handle(s *server, method, route string, h http.Handler) {
+	// The body limit applies first since the rate limiter may read the body
+	// to verify HMAC signatures
+	h = Chain(h, BodyLimit(a.routeBodyLimit(route)), a.rateLimitMiddleware(route, s.auth))
+	h = a.deps.Telemetry.WrapHandler(method, route, h)
+	h = a.deps.Metrics.WrapHandler(method, route, h)
+
+	s.router.Handler(method, route, h)
+}
 
-	logger.Info("API server running", zap.String("listenAddress", a.config.APIListenAddress))
+// handleRole registers a route that requires the given role; the route is not
+// registered if none of the listener's credentials grant that role
+func (a *API) handleRole(s *server, role Role, method, route string, h http.Handler) {
+	if !s.auth.enabled(role) {
+		a.log.Debug("not registering route; no credentials grant the required role",
+			zap.String("listener", s.name), zap.String("route", route), zap.String("role", role.String()))
+
+		return
+	}
 
-	return http.ListenAndServe(a.config.APIListenAddress, router)
+	a.handle(s, method, route, a.requireRole(s.auth, role, h))
 }
 
 // WriteJSON is a helper function for writing JSON responses
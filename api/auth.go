@@ -0,0 +1,363 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+// Role is the level of access granted to a request. Roles are ordered: admin
+// can do everything operator can, operator can do everything public can.
+type Role int
+
+const (
+	RolePublic Role = iota
+	RoleOperator
+	RoleAdmin
+)
+
+const (
+	AuthMethodToken      = "token"
+	AuthMethodHMAC       = "hmac"
+	AuthMethodClientCert = "mtls"
+)
+
+var (
+	errUnauthenticated = errors.New("missing or invalid credentials")
+	errForbidden       = errors.New("insufficient role")
+)
+
+type principalCtxKey struct{}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Name identifies the credential (token fingerprint, HMAC key ID or
+	// client certificate subject); it never contains the secret itself.
+	Name   string
+	Method string
+	Role   Role
+}
+
+type tokenEntry struct {
+	token []byte
+	name  string
+	role  Role
+}
+
+type hmacKey struct {
+	secret []byte
+	role   Role
+}
+
+// authenticator holds all credentials that are accepted by a listener
+type authenticator struct {
+	tokens      []*tokenEntry
+	hmacKeys    map[string]*hmacKey
+	hmacMaxSkew time.Duration
+	certRoles   map[string]Role
+}
+
+func (r Role) String() string {
+	switch r {
+	case RolePublic:
+		return "public"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "public":
+		return RolePublic, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RolePublic, fmt.Errorf("unknown role '%s'", s)
+	}
+}
+
+// PrincipalFromContext returns the principal set by requireRole()
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(*Principal)
+	return p, ok
+}
+
+func newAuthenticator(cfg *config.AuthConfig) (*authenticator, error) {
+	auth := &authenticator{
+		hmacKeys:    make(map[string]*hmacKey),
+		hmacMaxSkew: time.Duration(cfg.AuthHMACMaxSkewSec) * time.Second,
+		certRoles:   make(map[string]Role),
+	}
+
+	for _, t := range cfg.OperatorTokens {
+		auth.addToken(t, RoleOperator)
+	}
+
+	for _, t := range cfg.AdminTokens {
+		auth.addToken(t, RoleAdmin)
+	}
+
+	if cfg.AuthTokensFile != "" {
+		if err := auth.loadTokensFile(cfg.AuthTokensFile); err != nil {
+			return nil, errors.Wrap(err, "unable to load auth tokens file")
+		}
+	}
+
+	for id, secret := range cfg.AuthHMACOperatorKeys {
+		auth.hmacKeys[id] = &hmacKey{secret: []byte(secret), role: RoleOperator}
+	}
+
+	for id, secret := range cfg.AuthHMACAdminKeys {
+		if _, ok := auth.hmacKeys[id]; ok {
+			return nil, fmt.Errorf("HMAC key ID '%s' is configured for more than one role", id)
+		}
+
+		auth.hmacKeys[id] = &hmacKey{secret: []byte(secret), role: RoleAdmin}
+	}
+
+	for _, name := range cfg.AuthClientCertOperators {
+		auth.certRoles[name] = RoleOperator
+	}
+
+	// Admin wins if a name is listed for both roles
+	for _, name := range cfg.AuthClientCertAdmins {
+		auth.certRoles[name] = RoleAdmin
+	}
+
+	return auth, nil
+}
+
+func (au *authenticator) addToken(token string, role Role) {
+	token = strings.TrimSpace(token)
+
+	if token == "" {
+		return
+	}
+
+	au.tokens = append(au.tokens, &tokenEntry{
+		token: []byte(token),
+		name:  tokenFingerprint(token),
+		role:  role,
+	})
+}
+
+// loadTokensFile loads tokens from a file (ie. a mounted K8S secret) that
+// contains one "<role>:<token>" entry per line; empty lines and lines starting
+// with '#' are ignored.
+func (au *authenticator) loadTokensFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to open file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		roleStr, token, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(token) == "" {
+			return fmt.Errorf("line %d: expected '<role>:<token>'", lineNum)
+		}
+
+		role, err := ParseRole(roleStr)
+		if err != nil || role == RolePublic {
+			return fmt.Errorf("line %d: role must be 'operator' or 'admin'", lineNum)
+		}
+
+		au.addToken(token, role)
+	}
+
+	return errors.Wrap(scanner.Err(), "unable to read file")
+}
+
+// enabled returns true if any credential grants at least the given role
+func (au *authenticator) enabled(role Role) bool {
+	if role == RolePublic {
+		return true
+	}
+
+	for _, t := range au.tokens {
+		if t.role >= role {
+			return true
+		}
+	}
+
+	for _, k := range au.hmacKeys {
+		if k.role >= role {
+			return true
+		}
+	}
+
+	for _, r := range au.certRoles {
+		if r >= role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticate determines the principal of a request. Client certificates are
+// checked first, then HMAC signatures and finally bearer tokens. Presenting
+// invalid credentials of any kind fails the request even if another method
+// would succeed.
+func (au *authenticator) authenticate(r *http.Request) (*Principal, error) {
+	if p := au.clientCertPrincipal(r); p != nil {
+		return p, nil
+	}
+
+	if r.Header.Get(HMACSignatureHeader) != "" {
+		return au.verifyHMAC(r)
+	}
+
+	if token := bearerToken(r); token != "" {
+		return au.tokenPrincipal(token)
+	}
+
+	return nil, errUnauthenticated
+}
+
+func (au *authenticator) tokenPrincipal(token string) (*Principal, error) {
+	var match *tokenEntry
+
+	// Compare against every token to avoid leaking which one matched via timing
+	for _, t := range au.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 && (match == nil || t.role > match.role) {
+			match = t
+		}
+	}
+
+	if match == nil {
+		return nil, errUnauthenticated
+	}
+
+	return &Principal{Name: match.name, Method: AuthMethodToken, Role: match.role}, nil
+}
+
+// clientCertPrincipal maps a verified client certificate to a principal by
+// its common name, DNS or email SANs. Requests without a verified certificate
+// (or with an unknown one) return nil.
+func (au *authenticator) clientCertPrincipal(r *http.Request) *Principal {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(au.certRoles) == 0 {
+		return nil
+	}
+
+	var match *Principal
+
+	for _, name := range certNames(r.TLS.VerifiedChains[0][0]) {
+		role, ok := au.certRoles[name]
+		if !ok || (match != nil && role <= match.Role) {
+			continue
+		}
+
+		match = &Principal{Name: name, Method: AuthMethodClientCert, Role: role}
+	}
+
+	return match
+}
+
+func certNames(cert *x509.Certificate) []string {
+	names := make([]string, 0, 1+len(cert.DNSNames)+len(cert.EmailAddresses))
+
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+
+	return names
+}
+
+// requireRole only lets requests through whose principal has at least the
+// given role. Unauthenticated requests get a 401, authenticated requests with
+// an insufficient role get a 403.
+func (a *API) requireRole(auth *authenticator, role Role, h http.Handler) http.Handler {
+	if role == RolePublic {
+		return h
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		logger := a.requestLog(r)
+
+		p, err := auth.authenticate(r)
+		if err == nil && p.Role < role {
+			err = errForbidden
+		}
+
+		if err != nil {
+			logger.Warn("rejected unauthorized request",
+				zap.String("path", r.URL.Path),
+				zap.String("requiredRole", role.String()),
+				zap.String("remoteAddr", r.RemoteAddr),
+				zap.String("reason", err.Error()),
+			)
+
+			if err == errForbidden {
+				WriteProblem(rw, r, errs.Newf(errs.CodePermissionDenied, "the '%s' role is required", role))
+				return
+			}
+
+			rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, role))
+			WriteProblem(rw, r, errs.New(errs.CodeUnauthenticated, "missing or invalid credentials"))
+
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalCtxKey{}, p)
+		ctx = clog.WithContext(ctx, logger.With(
+			zap.String("principal", p.Name),
+			zap.String("authMethod", p.Method),
+		))
+
+		h.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// tokenFingerprint returns a short, non-reversible identifier for a token
+// that is safe to log
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
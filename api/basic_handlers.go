@@ -1,35 +1,90 @@
 package api
 
 import (
-	"encoding/json"
+	"bytes"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"go.uber.org/zap"
-)
 
-func (a *API) healthCheckHandler(wr http.ResponseWriter, r *http.Request) {
-	status := http.StatusOK
-	body := "ok"
+	"github.com/streamdal/go-svc-template/buildinfo"
+	"github.com/streamdal/go-svc-template/errs"
+)
 
+func (a *API) healthCheckHandler(rw http.ResponseWriter, r *http.Request) error {
 	if a.deps.Health.Failed() {
-		status = http.StatusInternalServerError
-		body = "failed"
+		return errs.New(errs.CodeUnavailable, "one or more fatal health checks are failing")
 	}
 
-	wr.WriteHeader(status)
-	wr.Write([]byte(body))
+	WriteJSON(rw, &ResponseJSON{Status: http.StatusOK, Message: "ok"}, http.StatusOK)
+
+	return nil
 }
 
-func (a *API) versionHandler(rw http.ResponseWriter, r *http.Request) {
-	logger := a.log.With(zap.String("method", "versionHandler"))
-	logger.Info("handling /version request", zap.String("remoteAddr", r.RemoteAddr))
+// versionHandler returns build and runtime info as JSON (default) or plain
+// text (Accept: text/plain)
+func (a *API) versionHandler(rw http.ResponseWriter, r *http.Request) error {
+	info := buildinfo.Get(a.config.ServiceName, a.config.EnvName, a.version)
+
+	if negotiateContentType(r, "application/json", "text/plain") != "text/plain" {
+		WriteJSON(rw, info, http.StatusOK)
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
 
-	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := info.WriteText(buf); err != nil {
+		return errs.Wrap(err, errs.CodeInternal, "unable to render version")
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	rw.WriteHeader(http.StatusOK)
 
-	response := &ResponseJSON{Status: http.StatusOK, Message: "your_org/go-svc-template " + a.version}
+	if _, err := rw.Write(buf.Bytes()); err != nil {
+		a.requestLog(r).Error("unable to write version response", zap.Error(err))
+	}
+
+	return nil
+}
 
-	if err := json.NewEncoder(rw).Encode(response); err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
+// negotiateContentType returns the offer that best matches the Accept header
+// (by q-value, then by the order of offers); the first offer is returned if
+// nothing matches or no Accept header is set
+func negotiateContentType(r *http.Request, offers ...string) string {
+	best, bestQ := offers[0], 0.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		for _, offer := range offers {
+			if q > bestQ && mediaTypeMatches(mediaType, offer) {
+				best, bestQ = offer, q
+			}
+		}
+	}
+
+	return best
+}
+
+func mediaTypeMatches(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
 	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+
+	return false
 }
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+const (
+	DefaultCacheKeysLimit = 1000
+	MaxCacheValueBytes    = 1024 * 1024
+)
+
+type CacheItemJSON struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+}
+
+type CacheSetRequestJSON struct {
+	Value json.RawMessage `json:"value"`
+
+	// TTLSeconds is optional; 0 means the item never expires
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+type CacheKeysJSON struct {
+	Prefix    string   `json:"prefix"`
+	Keys      []string `json:"keys"`
+	Total     int      `json:"total"`
+	Truncated bool     `json:"truncated"`
+}
+
+// cacheKeysHandler lists keys by prefix (?prefix=foo&limit=100)
+func (a *API) cacheKeysHandler(rw http.ResponseWriter, r *http.Request) error {
+	prefix := r.URL.Query().Get("prefix")
+	limit := DefaultCacheKeysLimit
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed < 1 {
+			return errs.Invalid("limit", "must be a positive integer")
+		}
+
+		limit = parsed
+	}
+
+	keys := a.deps.CacheBackend.Keys(prefix)
+
+	resp := &CacheKeysJSON{
+		Prefix: prefix,
+		Keys:   keys,
+		Total:  len(keys),
+	}
+
+	if len(keys) > limit {
+		resp.Keys = keys[:limit]
+		resp.Truncated = true
+	}
+
+	WriteJSON(rw, resp, http.StatusOK)
+
+	return nil
+}
+
+func (a *API) cacheStatsHandler(rw http.ResponseWriter, r *http.Request) error {
+	WriteJSON(rw, a.deps.CacheBackend.Stats(), http.StatusOK)
+	return nil
+}
+
+func (a *API) cacheGetHandler(rw http.ResponseWriter, r *http.Request) error {
+	key := cacheKeyParam(r)
+
+	value, expiresAt, ok := a.deps.CacheBackend.GetWithExpiration(key)
+	if !ok {
+		return errs.New(errs.CodeNotFound, "key not found")
+	}
+
+	item := &CacheItemJSON{
+		Key:   key,
+		Value: value,
+	}
+
+	// Values set from code are not guaranteed to be JSON friendly
+	if _, err := json.Marshal(value); err != nil {
+		item.Value = fmt.Sprintf("%v", value)
+	}
+
+	if !expiresAt.IsZero() {
+		item.ExpiresAt = &expiresAt
+	}
+
+	WriteJSON(rw, item, http.StatusOK)
+
+	return nil
+}
+
+func (a *API) cacheSetHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "cacheSetHandler"))
+
+	key := cacheKeyParam(r)
+
+	if key == "" {
+		return errs.Invalid("key", "cannot be empty")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxCacheValueBytes+1))
+	if err != nil {
+		return bodyReadError(err)
+	}
+
+	if len(data) > MaxCacheValueBytes {
+		return errs.Newf(errs.CodePayloadTooLarge, "request body cannot exceed %d bytes", MaxCacheValueBytes)
+	}
+
+	req := &CacheSetRequestJSON{}
+
+	if err := json.Unmarshal(data, req); err != nil {
+		return errs.New(errs.CodeInvalidArgument, "unable to parse request body: "+err.Error())
+	}
+
+	verr := errs.New(errs.CodeInvalidArgument, "request is invalid")
+
+	if len(req.Value) == 0 {
+		verr.WithField("value", "must be set")
+	}
+
+	if req.TTLSeconds < 0 {
+		verr.WithField("ttl_seconds", "cannot be negative")
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	value, err := decodeCacheValue(req.Value)
+	if err != nil {
+		return errs.Invalid("value", "unable to parse value: "+err.Error())
+	}
+
+	// Code reading the key asserts its own type (ie. the rate limiter's int
+	// counters); only allow overwriting a value with one of the same type
+	if existing, ok := a.deps.CacheBackend.Get(key); ok && reflect.TypeOf(existing) != reflect.TypeOf(value) {
+		return errs.Newf(errs.CodeConflict, "key holds a value of type %T; cannot overwrite it with a value of type %T",
+			existing, value)
+	}
+
+	a.deps.CacheBackend.SetWithTTL(key, value, time.Duration(req.TTLSeconds)*time.Second)
+
+	logger.Info("cache key set via admin API",
+		zap.String("key", key),
+		zap.Int("ttlSeconds", req.TTLSeconds),
+		zap.String("remoteAddr", r.RemoteAddr),
+	)
+
+	WriteJSON(rw, &ResponseJSON{Status: http.StatusOK, Message: "ok"}, http.StatusOK)
+
+	return nil
+}
+
+func (a *API) cacheDeleteHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "cacheDeleteHandler"))
+
+	key := cacheKeyParam(r)
+
+	if !a.deps.CacheBackend.Remove(key) {
+		return errs.New(errs.CodeNotFound, "key not found")
+	}
+
+	logger.Info("cache key deleted via admin API",
+		zap.String("key", key),
+		zap.String("remoteAddr", r.RemoteAddr),
+	)
+
+	WriteJSON(rw, &ResponseJSON{Status: http.StatusOK, Message: "ok"}, http.StatusOK)
+
+	return nil
+}
+
+// decodeCacheValue decodes a JSON value the way Go code would store it:
+// integral numbers become int (rather than float64), other numbers float64
+func decodeCacheValue(raw json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var value interface{}
+
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if n, err := strconv.Atoi(t.String()); err == nil {
+			return n
+		}
+
+		f, _ := t.Float64()
+
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = convertNumbers(e)
+		}
+	}
+
+	return v
+}
+
+// cacheKeyParam extracts the key from the catch-all route param; keys may
+// contain slashes.
+func cacheKeyParam(r *http.Request) string {
+	return strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("key"), "/")
+}
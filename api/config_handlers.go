@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+// configHandler returns the effective config (with secrets redacted) and the
+// source of every value (as of the last config reload)
+func (a *API) configHandler(rw http.ResponseWriter, r *http.Request) error {
+	cfg := a.config
+
+	if a.deps.Reloader != nil {
+		cfg = a.deps.Reloader.Current()
+	}
+
+	effective, err := cfg.Effective()
+	if err != nil {
+		return errs.Wrap(err, errs.CodeUnavailable, "effective config is not available")
+	}
+
+	WriteJSON(rw, effective, http.StatusOK)
+
+	return nil
+}
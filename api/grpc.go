@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/streamdal/go-svc-template/deps"
+)
+
+// GRPCRegisterFunc registers a gRPC service on the server (ie.
+// pb.RegisterFooServer(s, impl))
+type GRPCRegisterFunc func(s grpc.ServiceRegistrar)
+
+// RegisterGRPC adds a service to the gRPC server; must be called before Run().
+// It is a no-op if the gRPC listener is disabled.
+func (a *API) RegisterGRPC(fn GRPCRegisterFunc) {
+	a.grpcServices = append(a.grpcServices, fn)
+}
+
+// newGRPCServer builds the gRPC server with the health service, reflection
+// (if enabled) and every service added via RegisterGRPC()
+func (a *API) newGRPCServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.unaryInterceptors()...),
+		grpc.ChainStreamInterceptor(a.streamInterceptors()...),
+	}
+
+	if cert, ok := a.deps.TLSCerts[deps.ListenerGRPC]; ok {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(cert.TLSConfig())))
+	}
+
+	srv := grpc.NewServer(opts...)
+
+	healthpb.RegisterHealthServer(srv, &grpcHealth{
+		api:          a,
+		pollInterval: a.grpcHealthPollInterval(),
+	})
+
+	if a.config.GRPCReflection {
+		reflection.Register(srv)
+	}
+
+	for _, fn := range a.grpcServices {
+		fn(srv)
+	}
+
+	return srv
+}
+
+func (a *API) grpcHealthPollInterval() time.Duration {
+	if a.config.HealthFreqSec <= 0 {
+		return time.Second
+	}
+
+	return time.Duration(a.config.HealthFreqSec) * time.Second
+}
+
+func (a *API) runGRPC() error {
+	lis, err := net.Listen("tcp", a.config.GRPCListenAddress)
+	if err != nil {
+		return errors.Wrap(err, "unable to listen for gRPC")
+	}
+
+	srv := a.newGRPCServer()
+
+	a.log.Info("server running",
+		zap.String("listener", deps.ListenerGRPC),
+		zap.String("listenAddress", a.config.GRPCListenAddress),
+		zap.Bool("tls", a.deps.TLSCerts[deps.ListenerGRPC] != nil),
+		zap.Int("numServices", len(srv.GetServiceInfo())),
+	)
+
+	return srv.Serve(lis)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Service names understood by the gRPC health service in addition to the
+// names of individual health checks. The empty service name reports readiness.
+const (
+	GRPCHealthLiveness  = "liveness"
+	GRPCHealthReadiness = "readiness"
+	GRPCHealthStartup   = "startup"
+)
+
+// grpcHealth implements grpc.health.v1.Health on top of deps.Health and the
+// same probe logic that backs /live, /ready and /startup
+type grpcHealth struct {
+	healthpb.UnimplementedHealthServer
+
+	api          *API
+	pollInterval time.Duration
+}
+
+func (g *grpcHealth) Check(_ context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, ok := g.status(req.GetService())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service '%s'", req.GetService())
+	}
+
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch sends the current status and then every change until the client
+// goes away; unknown services are reported as SERVICE_UNKNOWN as per spec.
+func (g *grpcHealth) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(g.pollInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+
+	for {
+		st, ok := g.status(req.GetService())
+		if !ok {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+
+			last = st
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// status returns the serving status of a service; false if the service is
+// not known
+func (g *grpcHealth) status(service string) (healthpb.HealthCheckResponse_ServingStatus, bool) {
+	var problems map[string]string
+
+	switch service {
+	case "", GRPCHealthReadiness:
+		problems = g.api.readyProblems()
+	case GRPCHealthLiveness:
+		problems = g.api.liveProblems()
+	case GRPCHealthStartup:
+		problems = g.api.startupProblems()
+	default:
+		states, _, err := g.api.deps.Health.State()
+		if err != nil {
+			return healthpb.HealthCheckResponse_NOT_SERVING, true
+		}
+
+		state, ok := states[service]
+		if !ok {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, false
+		}
+
+		if state.Status != "ok" {
+			return healthpb.HealthCheckResponse_NOT_SERVING, true
+		}
+
+		return healthpb.HealthCheckResponse_SERVING, true
+	}
+
+	if len(problems) > 0 {
+		return healthpb.HealthCheckResponse_NOT_SERVING, true
+	}
+
+	return healthpb.HealthCheckResponse_SERVING, true
+}
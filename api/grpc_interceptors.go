@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/errs"
+	"github.com/streamdal/go-svc-template/telemetry"
+)
+
+// grpcRequestIDKey is the metadata key used for request IDs; gRPC metadata
+// keys are always lower case
+const grpcRequestIDKey = "x-request-id"
+
+// The gRPC interceptors mirror the HTTP middleware: request IDs (with a
+// request-scoped logger), tracing, access logs and panic recovery.
+
+func (a *API) unaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			ctx = a.grpcRequestContext(ctx)
+
+			ctx, txn := a.deps.Telemetry.StartTransaction(ctx, info.FullMethod, telemetry.WithHeaders(metadataHeaders(ctx)))
+			defer txn.End()
+
+			started := time.Now()
+
+			// cause is the error returned by the handler, before conversion
+			var cause error
+
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					err = a.grpcRecovered(ctx, info.FullMethod, recovered)
+					cause = err
+				}
+
+				if cause != nil {
+					txn.NoticeError(cause)
+				}
+
+				txn.SetAttribute("grpc.code", status.Code(err).String())
+				a.grpcAccessLog(ctx, info.FullMethod, started, err, cause)
+			}()
+
+			resp, cause = handler(ctx, req)
+
+			return resp, grpcError(cause)
+		},
+	}
+}
+
+func (a *API) streamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			ctx := a.grpcRequestContext(ss.Context())
+
+			ctx, txn := a.deps.Telemetry.StartTransaction(ctx, info.FullMethod, telemetry.WithHeaders(metadataHeaders(ctx)))
+			defer txn.End()
+
+			started := time.Now()
+
+			// cause is the error returned by the handler, before conversion
+			var cause error
+
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					err = a.grpcRecovered(ctx, info.FullMethod, recovered)
+					cause = err
+				}
+
+				if cause != nil {
+					txn.NoticeError(cause)
+				}
+
+				txn.SetAttribute("grpc.code", status.Code(err).String())
+				a.grpcAccessLog(ctx, info.FullMethod, started, err, cause)
+			}()
+
+			cause = handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+
+			return grpcError(cause)
+		},
+	}
+}
+
+// grpcRequestContext propagates an incoming x-request-id (or generates a new
+// one), echoes it as response header and attaches a request-scoped logger
+func (a *API) grpcRequestContext(ctx context.Context) context.Context {
+	id := ""
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(grpcRequestIDKey); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+
+	// Errors only occur if headers were already sent, which cannot be the case
+	_ = grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, id))
+
+	ctx = context.WithValue(ctx, requestIDCtxKey{}, id)
+
+	return clog.WithContext(ctx, a.log.With(zap.String("requestId", id)))
+}
+
+func (a *API) grpcAccessLog(ctx context.Context, method string, started time.Time, err, cause error) {
+	if !a.config.AccessLogEnabled {
+		return
+	}
+
+	for _, p := range a.config.AccessLogExcludePaths {
+		if p == method {
+			return
+		}
+	}
+
+	remoteAddr := ""
+
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	fields := []zap.Field{
+		zap.String("grpcMethod", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(started)),
+		zap.String("remoteAddr", remoteAddr),
+	}
+
+	if cause != nil {
+		fields = append(fields, zap.Error(cause))
+	}
+
+	grpcLog(ctx, a.log).Info("access", fields...)
+}
+
+// grpcRecovered logs a recovered panic and returns the error sent to the client
+func (a *API) grpcRecovered(ctx context.Context, method string, recovered interface{}) error {
+	grpcLog(ctx, a.log).Error("recovered from panic in gRPC handler",
+		zap.String("grpcMethod", method),
+		zap.String("panic", fmt.Sprintf("%v", recovered)),
+		zap.String("stack", string(debug.Stack())),
+	)
+
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// grpcCodes maps errs codes to gRPC status codes
+var grpcCodes = map[errs.Code]codes.Code{
+	errs.CodeInvalidArgument:  codes.InvalidArgument,
+	errs.CodeUnauthenticated:  codes.Unauthenticated,
+	errs.CodePermissionDenied: codes.PermissionDenied,
+	errs.CodeNotFound:         codes.NotFound,
+	errs.CodeMethodNotAllowed: codes.Unimplemented,
+	errs.CodeConflict:         codes.AlreadyExists,
+	errs.CodePayloadTooLarge:  codes.ResourceExhausted,
+	errs.CodeRateLimited:      codes.ResourceExhausted,
+	errs.CodeUpstream:         codes.Unavailable,
+	errs.CodeUnavailable:      codes.Unavailable,
+	errs.CodeTimeout:          codes.DeadlineExceeded,
+	errs.CodeInternal:         codes.Internal,
+}
+
+// grpcError converts an *errs.Error returned by a handler into a gRPC status
+// so that handlers can share the error model with HTTP. Errors that already
+// carry a status are returned as-is.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	e := errs.From(err)
+
+	code, ok := grpcCodes[e.Code]
+	if !ok {
+		code = codes.Internal
+	}
+
+	return status.Error(code, e.Message)
+}
+
+// grpcLog returns the request-scoped logger or fallback
+func grpcLog(ctx context.Context, fallback clog.ICustomLog) clog.ICustomLog {
+	if log, ok := clog.FromContext(ctx); ok {
+		return log
+	}
+
+	return fallback
+}
+
+// metadataHeaders converts incoming metadata so that telemetry providers can
+// pick up an upstream trace context
+func metadataHeaders(ctx context.Context) map[string]interface{} {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	headers := make(map[string]interface{}, len(md))
+
+	for k, v := range md {
+		if len(v) > 0 {
+			headers[k] = v[0]
+		}
+	}
+
+	return headers
+}
+
+// contextStream overrides the context of a server stream so that handlers see
+// the request-scoped values set by the interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (c *contextStream) Context() context.Context {
+	return c.ctx
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+type HealthResponseJSON struct {
+	Status string                      `json:"status"`
+	Failed bool                        `json:"failed"`
+	Checks map[string]*CheckStatusJSON `json:"checks"`
+}
+
+type CheckStatusJSON struct {
+	Name               string      `json:"name"`
+	Status             string      `json:"status"`
+	Fatal              bool        `json:"fatal"`
+	Error              string      `json:"error,omitempty"`
+	Details            interface{} `json:"details,omitempty"`
+	DurationMs         float64     `json:"duration_ms"`
+	CheckTime          time.Time   `json:"check_time"`
+	ContiguousFailures int64       `json:"num_failures"`
+	FirstFailureAt     *time.Time  `json:"first_failure_at,omitempty"`
+}
+
+// healthHandler reports every registered health check as JSON.
+//
+// Query params:
+//
+//	check   - comma separated list of check names to include (default: all)
+//	verbose - include check details (default: false)
+func (a *API) healthHandler(rw http.ResponseWriter, r *http.Request) error {
+	states, failed, err := a.deps.Health.State()
+	if err != nil {
+		return errs.Wrap(err, errs.CodeInternal, "unable to fetch health state")
+	}
+
+	verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+
+	names := make([]string, 0)
+
+	if filter := r.URL.Query().Get("check"); filter != "" {
+		for _, name := range strings.Split(filter, ",") {
+			name = strings.TrimSpace(name)
+
+			if _, ok := states[name]; !ok {
+				return errs.Newf(errs.CodeNotFound, "unknown check '%s'", name)
+			}
+
+			names = append(names, name)
+		}
+	} else {
+		for name := range states {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	resp := &HealthResponseJSON{
+		Status: "ok",
+		Failed: failed,
+		Checks: make(map[string]*CheckStatusJSON, len(names)),
+	}
+
+	for _, name := range names {
+		state := states[name]
+
+		check := &CheckStatusJSON{
+			Name:               name,
+			Status:             state.Status,
+			Fatal:              state.Fatal,
+			Error:              state.Err,
+			CheckTime:          state.CheckTime,
+			ContiguousFailures: state.ContiguousFailures,
+		}
+
+		if a.deps.HealthTimings != nil {
+			check.DurationMs = float64(a.deps.HealthTimings.Duration(name)) / float64(time.Millisecond)
+		}
+
+		if !state.TimeOfFirstFailure.IsZero() {
+			firstFailure := state.TimeOfFirstFailure
+			check.FirstFailureAt = &firstFailure
+		}
+
+		if verbose {
+			check.Details = state.Details
+		}
+
+		if state.Status != "ok" {
+			resp.Status = "failed"
+		}
+
+		resp.Checks[name] = check
+	}
+
+	status := http.StatusOK
+
+	if failed {
+		status = http.StatusServiceUnavailable
+	}
+
+	WriteJSON(rw, resp, status)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+const MaxLogLevelBodyBytes = 4096
+
+type LogLevelRequestJSON struct {
+	// Pkg is the value of the "pkg" log field; empty changes the default level
+	Pkg   string `json:"pkg"`
+	Level string `json:"level"`
+
+	// TTLSeconds is optional; defaults to LogLevelDefaultTTLSec
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+func (a *API) logLevelsHandler(rw http.ResponseWriter, r *http.Request) error {
+	WriteJSON(rw, a.deps.LogLevels.State(), http.StatusOK)
+	return nil
+}
+
+// logLevelSetHandler temporarily changes the level for a pkg (or the default
+// level); the change reverts automatically once the TTL passes
+func (a *API) logLevelSetHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "logLevelSetHandler"))
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxLogLevelBodyBytes+1))
+	if err != nil {
+		return bodyReadError(err)
+	}
+
+	if len(data) > MaxLogLevelBodyBytes {
+		return errs.Newf(errs.CodePayloadTooLarge, "request body cannot exceed %d bytes", MaxLogLevelBodyBytes)
+	}
+
+	req := &LogLevelRequestJSON{}
+
+	if err := json.Unmarshal(data, req); err != nil {
+		return errs.New(errs.CodeInvalidArgument, "unable to parse request body: "+err.Error())
+	}
+
+	verr := errs.New(errs.CodeInvalidArgument, "request is invalid")
+
+	level, err := zapcore.ParseLevel(req.Level)
+	if err != nil || level > zapcore.ErrorLevel {
+		verr.WithField("level", "must be one of debug, info, warn, error")
+	}
+
+	if req.TTLSeconds == 0 {
+		req.TTLSeconds = a.config.LogLevelDefaultTTLSec
+	}
+
+	if req.TTLSeconds < 1 || req.TTLSeconds > a.config.LogLevelMaxTTLSec {
+		verr.WithField("ttl_seconds", fmt.Sprintf("must be between 1 and %d", a.config.LogLevelMaxTTLSec))
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+
+	if err := a.deps.LogLevels.SetLevel(req.Pkg, level, ttl); err != nil {
+		return errs.Wrap(err, errs.CodeInternal, "unable to set log level")
+	}
+
+	// Logged at warn so that the change is visible regardless of the level
+	logger.Warn("log level changed via admin API",
+		zap.String("logPkg", req.Pkg),
+		zap.String("level", level.String()),
+		zap.Int("ttlSeconds", req.TTLSeconds),
+		zap.String("remoteAddr", r.RemoteAddr),
+	)
+
+	WriteJSON(rw, a.deps.LogLevels.State(), http.StatusOK)
+
+	return nil
+}
+
+// logLevelResetHandler removes an override before its TTL passes
+// (?pkg=foo; no pkg resets the default level)
+func (a *API) logLevelResetHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "logLevelResetHandler"))
+
+	pkg := r.URL.Query().Get("pkg")
+
+	if !a.deps.LogLevels.Reset(pkg) {
+		return errs.New(errs.CodeNotFound, "no log level override for pkg")
+	}
+
+	logger.Warn("log level override removed via admin API",
+		zap.String("logPkg", pkg),
+		zap.String("remoteAddr", r.RemoteAddr),
+	)
+
+	WriteJSON(rw, a.deps.LogLevels.State(), http.StatusOK)
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// MaxRequestIDLength limits the size of client supplied request IDs
+	MaxRequestIDLength = 128
+)
+
+// Middleware wraps a handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+type requestIDCtxKey struct{}
+
+type responseControllerCtxKey struct{}
+
+// Chain wraps h with the given middlewares; the first middleware is the
+// outermost one (ie. it runs first).
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	return h
+}
+
+// middlewares returns the default middleware stack applied to every request
+func (a *API) middlewares() []Middleware {
+	return []Middleware{
+		responseControllerMiddleware,
+		a.requestIDMiddleware,
+		a.accessLogMiddleware,
+		a.recoveryMiddleware,
+		a.corsMiddleware,
+	}
+}
+
+// RequestIDFromContext returns the request ID set by the request ID middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// requestLog returns the request-scoped logger (which includes the request ID)
+// or the API logger if the request did not pass through the middleware
+func (a *API) requestLog(r *http.Request) clog.ICustomLog {
+	if log, ok := clog.FromContext(r.Context()); ok {
+		return log
+	}
+
+	return a.log
+}
+
+// requestIDMiddleware propagates a client supplied X-Request-ID (or generates
+// a new one), echoes it in the response and attaches a request-scoped logger
+func (a *API) requestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		rw.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDCtxKey{}, id)
+		ctx = clog.WithContext(ctx, a.log.With(zap.String("requestId", id)))
+
+		h.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accessLogMiddleware writes a structured log entry for every request
+func (a *API) accessLogMiddleware(h http.Handler) http.Handler {
+	if !a.config.AccessLogEnabled {
+		return h
+	}
+
+	exclude := make(map[string]struct{}, len(a.config.AccessLogExcludePaths))
+
+	for _, p := range a.config.AccessLogExcludePaths {
+		exclude[p] = struct{}{}
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, ok := exclude[r.URL.Path]; ok {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		started := time.Now()
+		rec := &responseRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+
+		a.requestLog(r).Info("access",
+			zap.String("httpMethod", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("query", r.URL.RawQuery),
+			zap.Int("status", rec.status),
+			zap.Int64("bytes", rec.bytes),
+			zap.Duration("duration", time.Since(started)),
+			zap.String("remoteAddr", r.RemoteAddr),
+			zap.String("userAgent", r.UserAgent()),
+		)
+	})
+}
+
+// recoveryMiddleware turns a panicking handler into a 500 problem response
+func (a *API) recoveryMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: rw, status: http.StatusOK}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			// Let net/http deal with aborted handlers
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			a.requestLog(r).Error("recovered from panic in handler",
+				zap.String("path", r.URL.Path),
+				zap.String("panic", fmt.Sprintf("%v", recovered)),
+				zap.String("stack", string(debug.Stack())),
+			)
+
+			// Too late to change the response if the handler already wrote one
+			if rec.wroteHeader {
+				return
+			}
+
+			WriteProblem(rec, r, errs.New(errs.CodeInternal, "internal server error"))
+		}()
+
+		h.ServeHTTP(rec, r)
+	})
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers preflight
+// requests; it is a no-op if no allowed origins are configured
+func (a *API) corsMiddleware(h http.Handler) http.Handler {
+	if len(a.config.CORSAllowedOrigins) == 0 {
+		return h
+	}
+
+	allowAny := false
+	origins := make(map[string]struct{}, len(a.config.CORSAllowedOrigins))
+
+	for _, o := range a.config.CORSAllowedOrigins {
+		if o == "*" {
+			allowAny = true
+		}
+
+		origins[o] = struct{}{}
+	}
+
+	methods := strings.Join(a.config.CORSAllowedMethods, ", ")
+	headers := strings.Join(a.config.CORSAllowedHeaders, ", ")
+	maxAge := strconv.Itoa(a.config.CORSMaxAgeSec)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if origin == "" {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		rw.Header().Add("Vary", "Origin")
+
+		if _, ok := origins[origin]; !ok && !allowAny {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		// Never echo the origin for a wildcard: combined with credentials that
+		// would let any site make credentialed requests (config validation
+		// rejects the combination, this is a second line of defense)
+		if allowAny {
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if a.config.CORSAllowCredentials {
+				rw.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		rw.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+
+		// Preflight
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			rw.Header().Set("Access-Control-Allow-Methods", methods)
+			rw.Header().Set("Access-Control-Allow-Headers", headers)
+			rw.Header().Set("Access-Control-Max-Age", maxAge)
+			rw.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// responseControllerMiddleware stores a controller for the server's own
+// response writer so that streaming handlers can change deadlines even if a
+// wrapper further down (ie. New Relic's) does not support Unwrap
+func responseControllerMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseControllerCtxKey{}, http.NewResponseController(rw))
+		h.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// setWriteDeadline overrides the server's write timeout for a (streaming)
+// response
+func setWriteDeadline(rw http.ResponseWriter, r *http.Request, deadline time.Time) error {
+	err := http.NewResponseController(rw).SetWriteDeadline(deadline)
+	if err == nil || !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	rc, ok := r.Context().Value(responseControllerCtxKey{}).(*http.ResponseController)
+	if !ok {
+		return err
+	}
+
+	return rc.SetWriteDeadline(deadline)
+}
+
+// BodyLimit rejects request bodies larger than limit bytes with a 413; a
+// limit <= 0 disables the check. Handlers see a *http.MaxBytesError when
+// reading past the limit (see bodyReadError).
+func BodyLimit(limit int64) Middleware {
+	return func(h http.Handler) http.Handler {
+		if limit <= 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				WriteProblem(rw, r, errs.Newf(errs.CodePayloadTooLarge, "request body cannot exceed %d bytes", limit))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(rw, r.Body, limit)
+
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// routeBodyLimit returns the body limit for a route pattern
+func (a *API) routeBodyLimit(route string) int64 {
+	if limit, ok := a.config.HTTPRouteMaxBodyBytes[route]; ok {
+		return limit
+	}
+
+	// The publish endpoint has its own (larger) limit
+	if route == "/v1/publish" {
+		return int64(a.config.PublishMaxBodyBytes)
+	}
+
+	return a.config.HTTPMaxBodyBytes
+}
+
+// bodyReadError converts an error from reading the request body
+func bodyReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		return errs.Newf(errs.CodePayloadTooLarge, "request body cannot exceed %d bytes", maxBytesErr.Limit)
+	}
+
+	return errs.Wrap(err, errs.CodeInvalidArgument, "unable to read request body")
+}
+
+// responseRecorder captures the status code and number of bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+
+	return n, err
+}
+
+// Flush is needed for handlers that stream (pprof, SSE)
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// liveHandler should only fail on states we cannot recover from without a
+// restart: a failed fatal health check or a consumer group whose goroutines
+// have all exited.
+func (a *API) liveHandler(rw http.ResponseWriter, r *http.Request) {
+	writeProbe(rw, a.liveProblems())
+}
+
+// readyHandler fails whenever the pod should not receive work: consumers are
+// not (yet) started, the broker connection is down (consumers are paused) or
+// any health check - fatal or not - is failing.
+func (a *API) readyHandler(rw http.ResponseWriter, r *http.Request) {
+	writeProbe(rw, a.readyProblems())
+}
+
+// startupHandler succeeds once dependencies are set up and consumers have been
+// launched; until then, liveness and readiness probes are not evaluated by k8s.
+func (a *API) startupHandler(rw http.ResponseWriter, r *http.Request) {
+	writeProbe(rw, a.startupProblems())
+}
+
+// liveProblems, readyProblems and startupProblems return the reasons a probe
+// fails (empty if it passes); shared by the HTTP probes and gRPC health.
+func (a *API) liveProblems() map[string]string {
+	problems := make(map[string]string)
+
+	if a.deps.Health.Failed() {
+		problems["health"] = "one or more fatal health checks are failing"
+	}
+
+	if a.deps.ProcessorService.Started() {
+		for name, s := range a.deps.ProcessorService.Status() {
+			if s.Running == 0 {
+				problems["consumer."+name] = "all consumers have exited"
+			}
+		}
+	}
+
+	return problems
+}
+
+func (a *API) readyProblems() map[string]string {
+	problems := make(map[string]string)
+
+	if !a.deps.ProcessorService.Started() {
+		problems["consumers"] = "consumers have not been started"
+	}
+
+	for name, s := range a.deps.ProcessorService.Status() {
+		if !s.Connected {
+			problems["consumer."+name] = "broker connection is down"
+			continue
+		}
+
+		if a.deps.ProcessorService.Started() && s.Running < s.NumConsumers {
+			problems["consumer."+name] = fmt.Sprintf("%d/%d consumers running", s.Running, s.NumConsumers)
+		}
+	}
+
+	states, _, err := a.deps.Health.State()
+	if err != nil {
+		problems["health"] = "unable to fetch health state: " + err.Error()
+	}
+
+	for name, state := range states {
+		if state.Status != "ok" {
+			problems["check."+name] = state.Err
+		}
+	}
+
+	return problems
+}
+
+func (a *API) startupProblems() map[string]string {
+	problems := make(map[string]string)
+
+	if !a.deps.ProcessorService.Started() {
+		problems["consumers"] = "consumers have not been started"
+	}
+
+	return problems
+}
+
+func writeProbe(rw http.ResponseWriter, problems map[string]string) {
+	if len(problems) > 0 {
+		WriteJSON(rw, &ResponseJSON{
+			Status:  http.StatusServiceUnavailable,
+			Message: "failed",
+			Values:  problems,
+		}, http.StatusServiceUnavailable)
+
+		return
+	}
+
+	WriteJSON(rw, &ResponseJSON{Status: http.StatusOK, Message: "ok"}, http.StatusOK)
+}
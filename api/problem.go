@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypeDefault is used as the problem type; clients should use
+	// "code" to distinguish errors
+	ProblemTypeDefault = "about:blank"
+)
+
+// ProblemJSON is an RFC 7807 problem details response
+type ProblemJSON struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	Code      errs.Code          `json:"code"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []*errs.FieldError `json:"errors,omitempty"`
+}
+
+// HandlerFunc is a handler that can return an error; returned errors are
+// rendered as problem details (see WriteProblem).
+type HandlerFunc func(rw http.ResponseWriter, r *http.Request) error
+
+func (h HandlerFunc) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := h(rw, r); err != nil {
+		WriteProblem(rw, r, err)
+	}
+}
+
+// WriteProblem renders err as application/problem+json. Errors that are not
+// an *errs.Error become a generic 500; 5xx errors are logged with their cause
+// via the request-scoped logger.
+func WriteProblem(rw http.ResponseWriter, r *http.Request, err error) {
+	e := errs.From(err)
+	status := e.HTTPStatus()
+
+	problem := &ProblemJSON{
+		Type:      ProblemTypeDefault,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Message,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: RequestIDFromContext(r.Context()),
+		Errors:    e.Fields,
+	}
+
+	if status >= http.StatusInternalServerError {
+		logger, ok := clog.FromContext(r.Context())
+		if !ok {
+			logger = &clog.CustomLogNoop{}
+		}
+
+		logger.Error("request failed",
+			zap.String("path", r.URL.Path),
+			zap.String("code", string(e.Code)),
+			zap.Error(err),
+		)
+	}
+
+	data, jsonErr := json.Marshal(problem)
+	if jsonErr != nil {
+		log.Printf("ERROR: unable to marshal problem JSON: %s\n", jsonErr)
+		return
+	}
+
+	rw.Header().Set("Content-Type", ProblemContentType)
+	rw.WriteHeader(status)
+
+	if _, err := rw.Write(data); err != nil {
+		log.Printf("ERROR: unable to write resp in WriteProblem: %s\n", err)
+	}
+}
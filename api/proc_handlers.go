@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/streamdal/go-svc-template/errs"
+	"github.com/streamdal/go-svc-template/services/proc"
+)
+
+type ProcStatusResponseJSON struct {
+	Started   bool                        `json:"started"`
+	Paused    bool                        `json:"paused"`
+	Consumers map[string]*proc.Inspection `json:"consumers"`
+}
+
+// procStatusHandler reports, per consumer (RabbitMap entry), the local
+// consumer goroutines, the broker connection and the queue depth as seen by
+// the broker (?consumer=main limits the response to a single entry)
+func (a *API) procStatusHandler(rw http.ResponseWriter, r *http.Request) error {
+	var consumers map[string]*proc.Inspection
+
+	// Only the requested entry's queue is declared on the broker
+	if name := r.URL.Query().Get("consumer"); name != "" {
+		c, err := a.deps.ProcessorService.InspectConsumer(name)
+		if err != nil {
+			if errors.Is(err, proc.ErrUnknownConsumer) {
+				return errs.Newf(errs.CodeNotFound, "unknown consumer '%s'", name)
+			}
+
+			return errs.Wrap(err, errs.CodeInternal, "unable to inspect consumer")
+		}
+
+		consumers = map[string]*proc.Inspection{name: c}
+	} else {
+		consumers = a.deps.ProcessorService.Inspect()
+	}
+
+	WriteJSON(rw, &ProcStatusResponseJSON{
+		Started:   a.deps.ProcessorService.Started(),
+		Paused:    a.deps.ProcessorService.Paused(),
+		Consumers: consumers,
+	}, http.StatusOK)
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/backends/publisher"
+	"github.com/streamdal/go-svc-template/errs"
+)
+
+const (
+	BodyEncodingJSON   = "json"
+	BodyEncodingRaw    = "raw"
+	BodyEncodingBase64 = "base64"
+
+	MaxRoutingKeyLength = 255
+)
+
+// PublishRequestJSON is a single message to publish. Body is interpreted based
+// on BodyEncoding:
+//
+//	json   (default) - body is any JSON value and is published as-is
+//	raw    - body must be a JSON string; its contents are published
+//	base64 - body must be a base64 encoded JSON string (for binary payloads)
+type PublishRequestJSON struct {
+	RoutingKey   string                 `json:"routing_key"`
+	Headers      map[string]interface{} `json:"headers,omitempty"`
+	Body         json.RawMessage        `json:"body"`
+	BodyEncoding string                 `json:"body_encoding,omitempty"`
+	MessageID    string                 `json:"message_id,omitempty"`
+}
+
+type PublishResultJSON struct {
+	MessageID string `json:"message_id"`
+	Error     string `json:"error,omitempty"`
+}
+
+type PublishResponseJSON struct {
+	Status  int                  `json:"status"`
+	Message string               `json:"message"`
+	Results []*PublishResultJSON `json:"results"`
+}
+
+// publishHandler publishes one message (JSON object) or a batch of messages
+// (JSON array) to the configured exchange and waits for publisher confirms.
+func (a *API) publishHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "publishHandler"))
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, int64(a.config.PublishMaxBodyBytes)+1))
+	if err != nil {
+		return bodyReadError(err)
+	}
+
+	if len(data) > a.config.PublishMaxBodyBytes {
+		return errs.Newf(errs.CodePayloadTooLarge, "request body cannot exceed %d bytes", a.config.PublishMaxBodyBytes)
+	}
+
+	reqs, err := parsePublishRequests(data)
+	if err != nil {
+		return errs.New(errs.CodeInvalidArgument, "unable to parse request body: "+err.Error())
+	}
+
+	if len(reqs) > a.config.PublishMaxBatchSize {
+		return errs.Newf(errs.CodeInvalidArgument, "batch cannot contain more than %d messages", a.config.PublishMaxBatchSize)
+	}
+
+	msgs := make([]*publisher.Message, 0, len(reqs))
+	verr := errs.New(errs.CodeInvalidArgument, "one or more messages are invalid")
+
+	for i, req := range reqs {
+		msg, err := req.toMessage()
+		if err != nil {
+			verr.WithField(fmt.Sprintf("[%d]", i), err.Error())
+			continue
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(a.config.PublishTimeoutSec)*time.Second)
+	defer cancel()
+
+	results, err := a.deps.PublisherBackend.Publish(ctx, msgs...)
+	if err != nil {
+		if errors.Is(err, publisher.ErrReconnecting) {
+			return errs.Wrap(err, errs.CodeUnavailable, "unable to publish: broker connection is being re-established")
+		}
+
+		return errs.Wrap(err, errs.CodeUpstream, "unable to publish")
+	}
+
+	resp := &PublishResponseJSON{
+		Status:  http.StatusOK,
+		Message: "ok",
+		Results: make([]*PublishResultJSON, 0, len(results)),
+	}
+
+	for _, res := range results {
+		result := &PublishResultJSON{MessageID: res.MessageID}
+
+		if res.Err != nil {
+			result.Error = res.Err.Error()
+			resp.Status = http.StatusBadGateway
+			resp.Message = "one or more messages could not be published"
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	logger.Debug("published messages via HTTP",
+		zap.Int("numMessages", len(msgs)),
+		zap.String("remoteAddr", r.RemoteAddr),
+	)
+
+	WriteJSON(rw, resp, resp.Status)
+
+	return nil
+}
+
+// parsePublishRequests accepts either a single request object or an array
+func parsePublishRequests(data []byte) ([]*PublishRequestJSON, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 {
+		return nil, errors.New("request body cannot be empty")
+	}
+
+	reqs := make([]*PublishRequestJSON, 0)
+
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &reqs); err != nil {
+			return nil, err
+		}
+	} else {
+		req := &PublishRequestJSON{}
+
+		if err := json.Unmarshal(data, req); err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	if len(reqs) == 0 {
+		return nil, errors.New("batch cannot be empty")
+	}
+
+	return reqs, nil
+}
+
+func (p *PublishRequestJSON) toMessage() (*publisher.Message, error) {
+	if p == nil {
+		return nil, errors.New("message cannot be null")
+	}
+
+	if p.RoutingKey == "" {
+		return nil, errors.New("routing_key cannot be empty")
+	}
+
+	if len(p.RoutingKey) > MaxRoutingKeyLength {
+		return nil, fmt.Errorf("routing_key cannot be longer than %d bytes", MaxRoutingKeyLength)
+	}
+
+	if len(p.Body) == 0 {
+		return nil, errors.New("body cannot be empty")
+	}
+
+	for k, v := range p.Headers {
+		if k == "" {
+			return nil, errors.New("header names cannot be empty")
+		}
+
+		// Only allow scalar values - JSON numbers decode as float64 which
+		// amqp.Table supports as-is
+		switch v.(type) {
+		case string, float64, bool:
+		default:
+			return nil, fmt.Errorf("header '%s' must be a string, number or bool", k)
+		}
+	}
+
+	msg := &publisher.Message{
+		RoutingKey: p.RoutingKey,
+		Headers:    p.Headers,
+		MessageID:  p.MessageID,
+	}
+
+	switch p.BodyEncoding {
+	case "", BodyEncodingJSON:
+		msg.Body = p.Body
+		msg.ContentType = "application/json"
+	case BodyEncodingRaw, BodyEncodingBase64:
+		var s string
+
+		if err := json.Unmarshal(p.Body, &s); err != nil {
+			return nil, fmt.Errorf("body must be a JSON string when body_encoding is '%s'", p.BodyEncoding)
+		}
+
+		if p.BodyEncoding == BodyEncodingRaw {
+			msg.Body = []byte(s)
+			msg.ContentType = "text/plain"
+			break
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode base64 body")
+		}
+
+		msg.Body = decoded
+		msg.ContentType = "application/octet-stream"
+	default:
+		return nil, fmt.Errorf("unknown body_encoding '%s'", p.BodyEncoding)
+	}
+
+	return msg, nil
+}
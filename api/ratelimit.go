@@ -0,0 +1,213 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/errs"
+	"github.com/streamdal/go-svc-template/ratelimit"
+)
+
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// rateLimits holds the limiter and the rules per route; replaced as a whole
+// when the config is reloaded
+type rateLimits struct {
+	limiter     *ratelimit.Limiter
+	defaultRule ratelimit.Rule
+	routes      map[string]ratelimit.Rule
+	exclude     map[string]struct{}
+
+	keyBy             string
+	header            string
+	trustForwardedFor bool
+	forwardedForHops  int
+}
+
+// newRateLimits returns nil if rate limiting is disabled. The limiter is
+// created once and kept across config reloads (so are its counters); the
+// store cannot be changed without a restart.
+func (a *API) newRateLimits(cfg *config.Config) (*rateLimits, error) {
+	if !cfg.RateLimitEnabled {
+		return nil, nil
+	}
+
+	defaultRule, err := ratelimit.ParseRule(cfg.RateLimitDefault)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid default rate limit")
+	}
+
+	rl := &rateLimits{
+		defaultRule:       defaultRule,
+		routes:            make(map[string]ratelimit.Rule),
+		exclude:           make(map[string]struct{}),
+		keyBy:             cfg.RateLimitKey,
+		header:            cfg.RateLimitHeader,
+		trustForwardedFor: cfg.RateLimitTrustForwardedFor,
+		forwardedForHops:  cfg.RateLimitForwardedForHops,
+	}
+
+	for route, s := range cfg.RateLimitRoutes {
+		rule, err := ratelimit.ParseRule(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rate limit for route '%s'", route)
+		}
+
+		rl.routes[route] = rule
+	}
+
+	for _, route := range cfg.RateLimitExcludeRoutes {
+		rl.exclude[route] = struct{}{}
+	}
+
+	if a.limiter == nil {
+		var store ratelimit.Store = ratelimit.NewMemoryStore()
+
+		if cfg.RateLimitStore == "cache" {
+			cs, err := ratelimit.NewCacheStore(a.deps.CacheBackend)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to create cache store")
+			}
+
+			store = cs
+		}
+
+		a.limiter, err = ratelimit.New(store)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create limiter")
+		}
+	}
+
+	rl.limiter = a.limiter
+
+	return rl, nil
+}
+
+// rule returns the rule for a route pattern; false if the route is excluded
+// or not limited
+func (rl *rateLimits) rule(route string) (ratelimit.Rule, bool) {
+	if _, ok := rl.exclude[route]; ok {
+		return ratelimit.Rule{}, false
+	}
+
+	rule, ok := rl.routes[route]
+	if !ok {
+		rule = rl.defaultRule
+	}
+
+	return rule, rule.Limit > 0
+}
+
+// rateLimitMiddleware limits requests per client for a route pattern; it is
+// a no-op while rate limiting is disabled or if the route is excluded. The
+// rules are looked up per request so that config reloads take effect. auth
+// is the listener's authenticator (used to key by principal).
+func (a *API) rateLimitMiddleware(route string, auth *authenticator) Middleware {
+	return func(h http.Handler) http.Handler {
+		return HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+			rl := a.rateLimits.Load()
+			if rl == nil {
+				h.ServeHTTP(rw, r)
+				return nil
+			}
+
+			rule, ok := rl.rule(route)
+			if !ok {
+				h.ServeHTTP(rw, r)
+				return nil
+			}
+
+			res, err := rl.limiter.Allow(route, rl.key(r, auth), rule)
+			if err != nil {
+				// Fail open; an unavailable store should not take the API down
+				a.requestLog(r).Warn("unable to check rate limit", zap.String("route", route), zap.Error(err))
+				h.ServeHTTP(rw, r)
+
+				return nil
+			}
+
+			resetSec := strconv.Itoa(int(math.Ceil(res.RetryAfter().Seconds())))
+
+			rw.Header().Set(RateLimitLimitHeader, strconv.Itoa(res.Limit))
+			rw.Header().Set(RateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+			rw.Header().Set(RateLimitResetHeader, resetSec)
+
+			if !res.Allowed {
+				a.deps.Metrics.HTTPRateLimited.WithLabelValues(route).Inc()
+
+				rw.Header().Set("Retry-After", resetSec)
+
+				return errs.Newf(errs.CodeRateLimited, "rate limit of %s exceeded; retry in %s seconds", rule, resetSec)
+			}
+
+			h.ServeHTTP(rw, r)
+
+			return nil
+		})
+	}
+}
+
+// key identifies the client as configured via RateLimitKey. In token mode
+// only verified credentials select a bucket (the request is authenticated
+// here, before the route's auth check); a client sending a new invalid
+// credential on every request would otherwise never be limited. Falls back
+// to the client IP.
+func (rl *rateLimits) key(r *http.Request, auth *authenticator) string {
+	switch rl.keyBy {
+	case "token":
+		if auth != nil {
+			if p, err := auth.authenticate(r); err == nil {
+				return "principal:" + p.Name
+			}
+		}
+	case "header":
+		if v := r.Header.Get(rl.header); v != "" {
+			return "header:" + hashKey(v)
+		}
+	}
+
+	return "ip:" + rl.clientIP(r)
+}
+
+// clientIP returns the remote address or, behind trusted proxies, the
+// X-Forwarded-For entry added by the outermost trusted proxy. Proxies append
+// to the header, so entries further left are client controlled.
+func (rl *rateLimits) clientIP(r *http.Request) string {
+	if rl.trustForwardedFor && rl.forwardedForHops > 0 {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			entries := strings.Split(strings.Join(xff, ","), ",")
+
+			// Fewer entries than trusted hops means the request did not pass
+			// through all proxies
+			if len(entries) >= rl.forwardedForHops {
+				return strings.TrimSpace(entries[len(entries)-rl.forwardedForHops])
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// hashKey bounds the size of client supplied values used as keys
+func hashKey(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/config"
+)
+
+// reloadConfig is subscribed to config reloads (see config.Reloader)
+func (a *API) reloadConfig(_, updated *config.Config, changes config.Changes) {
+	logger := a.log.With(zap.String("method", "reloadConfig"))
+
+	if changes.Has("rate-limit-enabled", "rate-limit-key", "rate-limit-header", "rate-limit-trust-forwarded-for",
+		"rate-limit-forwarded-for-hops", "rate-limit-default", "rate-limit-routes", "rate-limit-exclude-routes") {
+		rl, err := a.newRateLimits(updated)
+		if err != nil {
+			// Rules were validated by the config, so this is unexpected
+			logger.Error("unable to apply rate limit changes, keeping the previous limits", zap.Error(err))
+		} else {
+			a.rateLimits.Store(rl)
+			logger.Info("rate limits updated", zap.Bool("enabled", rl != nil))
+		}
+	}
+
+	if changes.Has("tail-enabled") {
+		a.tailEnabled.Store(updated.TailEnabled)
+		logger.Info("live tail toggled", zap.Bool("enabled", updated.TailEnabled))
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+
+	"github.com/streamdal/go-svc-template/errs"
+	"github.com/streamdal/go-svc-template/tlscert"
+)
+
+// server is a single listener with its own routes, TLS and auth config
+type server struct {
+	name    string
+	address string
+	auth    *authenticator
+	router  *httprouter.Router
+	api     *API
+
+	// cert is nil if TLS is disabled for this listener
+	cert *tlscert.Reloader
+}
+
+func (a *API) newServer(name, address string, auth *authenticator) *server {
+	router := httprouter.New()
+
+	// Render router errors the same way as handler errors
+	router.NotFound = HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) error {
+		return errs.New(errs.CodeNotFound, "route not found")
+	})
+
+	router.MethodNotAllowed = HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) error {
+		return errs.New(errs.CodeMethodNotAllowed, "method not allowed")
+	})
+
+	return &server{
+		name:    name,
+		address: address,
+		auth:    auth,
+		router:  router,
+		api:     a,
+		cert:    a.deps.TLSCerts[name],
+	}
+}
+
+func (s *server) run() error {
+	srv, err := s.httpServer()
+	if err != nil {
+		return errors.Wrap(err, "unable to create http server")
+	}
+
+	ln, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return errors.Wrapf(err, "unable to listen on '%s'", s.address)
+	}
+
+	if s.api.config.HTTPMaxConns > 0 {
+		ln = netutil.LimitListener(ln, s.api.config.HTTPMaxConns)
+	}
+
+	s.api.log.Info("server running",
+		zap.String("listener", s.name),
+		zap.String("listenAddress", s.address),
+		zap.Bool("tls", s.cert != nil),
+	)
+
+	if s.cert != nil {
+		// Certificates come from TLSConfig so that reloads are picked up
+		return srv.ServeTLS(ln, "", "")
+	}
+
+	return srv.Serve(ln)
+}
+
+// httpServer creates the http.Server with timeouts, limits and HTTP/2
+// settings from config
+func (s *server) httpServer() (*http.Server, error) {
+	cfg := s.api.config
+
+	srv := &http.Server{
+		Addr:              s.address,
+		Handler:           Chain(s.router, s.api.middlewares()...),
+		ReadTimeout:       time.Duration(cfg.HTTPReadTimeoutSec) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.HTTPReadHeaderTimeoutSec) * time.Second,
+		WriteTimeout:      time.Duration(cfg.HTTPWriteTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(cfg.HTTPIdleTimeoutSec) * time.Second,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+	}
+
+	h2 := &http2.Server{
+		MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+		MaxReadFrameSize:     cfg.HTTP2MaxReadFrameSize,
+		IdleTimeout:          srv.IdleTimeout,
+	}
+
+	if s.cert != nil {
+		srv.TLSConfig = s.cert.TLSConfig()
+
+		// Applies the HTTP/2 settings and enables h2 via ALPN
+		if err := http2.ConfigureServer(srv, h2); err != nil {
+			return nil, errors.Wrap(err, "unable to configure HTTP/2")
+		}
+
+		return srv, nil
+	}
+
+	if cfg.HTTP2Cleartext {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2)
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/errs"
+	"github.com/streamdal/go-svc-template/metrics"
+	"github.com/streamdal/go-svc-template/services/proc"
+)
+
+const (
+	// tailHeartbeatInterval keeps idle streams (and proxies) alive
+	tailHeartbeatInterval = 15 * time.Second
+
+	// tailMaxRoutingKeyLen is the AMQP limit for routing keys (shortstr)
+	tailMaxRoutingKeyLen = 255
+
+	// tailMaxRoutingKeyWords bounds the work done matching every delivery
+	tailMaxRoutingKeyWords = 32
+)
+
+// tailHandler streams deliveries handled by proc as Server-Sent Events:
+//
+//	GET /admin/proc/tail?consumer=main&routing_key=orders.#&header=tenant:acme&outcome=error,nack&sample=0.1
+//
+// Events are "delivery" (a proc.DeliveryEvent) and "dropped" (the number of
+// events dropped so far because the client could not keep up).
+func (a *API) tailHandler(rw http.ResponseWriter, r *http.Request) error {
+	logger := a.requestLog(r).With(zap.String("method", "tailHandler"))
+
+	if !a.tailEnabled.Load() {
+		return errs.New(errs.CodeNotFound, "live tail is disabled")
+	}
+
+	filter, err := parseTailFilter(r)
+	if err != nil {
+		return err
+	}
+
+	sub, err := a.deps.ProcessorService.SubscribeTail(filter)
+	if err != nil {
+		if errors.Is(err, proc.ErrTooManySubscribers) {
+			return errs.New(errs.CodeUnavailable, "too many live tail streams; try again later")
+		}
+
+		return errs.Wrap(err, errs.CodeInvalidArgument, "unable to subscribe: "+err.Error())
+	}
+
+	defer sub.Close()
+
+	maxDuration := time.Duration(a.config.TailMaxDurationSec) * time.Second
+
+	// The stream outlives the server's write timeout
+	if err := setWriteDeadline(rw, r, time.Now().Add(maxDuration+10*time.Second)); err != nil {
+		logger.Warn("unable to extend write deadline; stream will end at the server's write timeout", zap.Error(err))
+	}
+
+	rc := http.NewResponseController(rw)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		logger.Error("response writer does not support streaming", zap.Error(err))
+		return nil
+	}
+
+	logger.Info("live tail started", zap.String("remoteAddr", r.RemoteAddr))
+	defer logger.Info("live tail ended", zap.String("remoteAddr", r.RemoteAddr))
+
+	heartbeat := time.NewTicker(tailHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	timeout := time.NewTimer(maxDuration)
+	defer timeout.Stop()
+
+	var reportedDropped uint64
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-timeout.C:
+			// Tells the client why the stream ended (EventSource reconnects)
+			fmt.Fprint(rw, "event: timeout\ndata: {}\n\n")
+			rc.Flush()
+
+			return nil
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(rw, ": heartbeat\n\n")
+		case event := <-sub.C:
+			if dropped := sub.Dropped(); dropped != reportedDropped {
+				reportedDropped = dropped
+
+				if err = writeSSE(rw, "dropped", map[string]uint64{"dropped": dropped}); err != nil {
+					break
+				}
+			}
+
+			err = writeSSE(rw, "delivery", event)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		if err != nil {
+			logger.Debug("client went away", zap.Error(err))
+			return nil
+		}
+	}
+}
+
+func writeSSE(rw http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal event")
+	}
+
+	_, err = fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event, data)
+
+	return err
+}
+
+// parseTailFilter reads the filter from query params; header and outcome may
+// be repeated and outcome may be comma separated
+func parseTailFilter(r *http.Request) (*proc.TailFilter, error) {
+	q := r.URL.Query()
+	verr := errs.New(errs.CodeInvalidArgument, "request is invalid")
+
+	filter := &proc.TailFilter{
+		Consumer:   q.Get("consumer"),
+		RoutingKey: q.Get("routing_key"),
+	}
+
+	if len(filter.RoutingKey) > tailMaxRoutingKeyLen {
+		verr.WithField("routing_key", fmt.Sprintf("must be at most %d characters", tailMaxRoutingKeyLen))
+	} else if strings.Count(filter.RoutingKey, ".")+1 > tailMaxRoutingKeyWords {
+		verr.WithField("routing_key", fmt.Sprintf("must be at most %d words", tailMaxRoutingKeyWords))
+	}
+
+	for _, h := range q["header"] {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || k == "" {
+			verr.WithField("header", "must be in the format <name>:<value>")
+			continue
+		}
+
+		if filter.Headers == nil {
+			filter.Headers = make(map[string]string)
+		}
+
+		filter.Headers[k] = v
+	}
+
+	valid := map[string]struct{}{
+		proc.OutcomeError:        {},
+		proc.OutcomeUnacked:      {},
+		metrics.AckActionAck:     {},
+		metrics.AckActionNack:    {},
+		metrics.AckActionRequeue: {},
+		metrics.AckActionReject:  {},
+	}
+
+	for _, o := range q["outcome"] {
+		for _, outcome := range strings.Split(o, ",") {
+			if _, ok := valid[outcome]; !ok {
+				verr.WithField("outcome", fmt.Sprintf("unknown outcome '%s'", outcome))
+				continue
+			}
+
+			filter.Outcomes = append(filter.Outcomes, outcome)
+		}
+	}
+
+	if s := q.Get("sample"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			verr.WithField("sample", "must be a number in (0, 1]")
+		}
+
+		filter.SampleRate = rate
+	}
+
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+
+	return filter, nil
+}
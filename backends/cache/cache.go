@@ -1,6 +1,10 @@
 package cache
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	gcache "github.com/patrickmn/go-cache"
@@ -10,9 +14,22 @@ import (
 type ICache interface {
 	Add(key string, value interface{}) error
 	Set(key string, value interface{})
+	SetWithTTL(key string, value interface{}, ttl time.Duration)
 	Get(key string) (value interface{}, ok bool)
+	GetWithExpiration(key string) (value interface{}, expiresAt time.Time, ok bool)
 	Contains(key string) (exists bool)
 	Remove(key string) bool
+	Keys(prefix string) []string
+	Stats() *Stats
+}
+
+type Stats struct {
+	Items int `json:"items"`
+
+	// EstimatedBytes is a rough estimate of the memory used by keys + values;
+	// strings and byte slices are counted exactly, everything else is
+	// approximated by its JSON encoded size.
+	EstimatedBytes int64 `json:"estimated_bytes"`
 }
 
 type Cache struct {
@@ -37,10 +54,26 @@ func (c *Cache) Set(key string, value interface{}) {
 	c.Cache.Set(key, value, gcache.NoExpiration)
 }
 
+// SetWithTTL will add OR overwrite an element in the cache that expires after
+// ttl; a ttl <= 0 means the element never expires
+func (c *Cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = gcache.NoExpiration
+	}
+
+	c.Cache.Set(key, value, ttl)
+}
+
 func (c *Cache) Get(key string) (interface{}, bool) {
 	return c.Cache.Get(key)
 }
 
+// GetWithExpiration returns the element along with its expiration time (zero
+// if the element never expires)
+func (c *Cache) GetWithExpiration(key string) (interface{}, time.Time, bool) {
+	return c.Cache.GetWithExpiration(key)
+}
+
 func (c *Cache) Contains(key string) bool {
 	_, ok := c.Cache.Get(key)
 	return ok
@@ -56,3 +89,45 @@ func (c *Cache) Remove(key string) bool {
 
 	return true
 }
+
+// Keys returns a sorted list of all (non-expired) keys that start with prefix
+func (c *Cache) Keys(prefix string) []string {
+	keys := make([]string, 0)
+
+	for k := range c.Cache.Items() {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (c *Cache) Stats() *Stats {
+	stats := &Stats{}
+
+	for k, item := range c.Cache.Items() {
+		stats.Items++
+		stats.EstimatedBytes += int64(len(k)) + estimateSize(item.Object)
+	}
+
+	return stats
+}
+
+func estimateSize(v interface{}) int64 {
+	switch t := v.(type) {
+	case string:
+		return int64(len(t))
+	case []byte:
+		return int64(len(t))
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return int64(len(fmt.Sprintf("%v", v)))
+	}
+
+	return int64(len(data))
+}
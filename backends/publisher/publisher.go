@@ -0,0 +1,328 @@
+// Package publisher is used for publishing messages (with headers and publisher
+// confirms) to the configured exchange. It sits on top of a producer-mode
+// rabbit backend, which takes care of (re)connecting and declaring the exchange.
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/streamdal/rabbit"
+)
+
+var (
+	// ErrReconnecting is returned when the underlying rabbit backend is in the
+	// middle of re-establishing its connection
+	ErrReconnecting = errors.New("rabbit backend is reconnecting")
+
+	// ErrNacked is returned when the broker negatively acknowledges a message
+	ErrNacked = errors.New("message was nacked by broker")
+
+	// ErrUnroutable is returned when the broker returns a message because no
+	// queue is bound to the exchange with a matching routing key
+	ErrUnroutable = errors.New("message is unroutable")
+)
+
+type IPublisher interface {
+	// Publish publishes all messages and waits for broker confirms; the
+	// returned results are in the same order as msgs. Messages that cannot be
+	// routed to any queue fail with ErrUnroutable.
+	Publish(ctx context.Context, msgs ...*Message) ([]*Result, error)
+}
+
+type Message struct {
+	RoutingKey  string
+	Headers     map[string]interface{}
+	ContentType string
+	Body        []byte
+
+	// MessageID is generated if left empty
+	MessageID string
+}
+
+type Result struct {
+	MessageID string
+	Err       error
+}
+
+type Options struct {
+	// Rabbit must be a producer-mode rabbit backend
+	Rabbit *rabbit.Rabbit
+
+	// ExchangeName is the exchange messages are published to
+	ExchangeName string
+
+	AppID string
+}
+
+type Publisher struct {
+	options *Options
+	channel channel
+	returns *returnTracker
+	mtx     *sync.Mutex
+
+	// openChannel opens a confirm-mode channel; replaced in tests
+	openChannel func() (channel, error)
+}
+
+// confirmation is satisfied by *amqp.DeferredConfirmation
+type confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// channel is the part of *amqp.Channel used by the publisher
+type channel interface {
+	publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (confirmation, error)
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	IsClosed() bool
+	Close() error
+}
+
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+// publish publishes with mandatory set so that unroutable messages are
+// returned (see returnTracker) rather than silently dropped by the broker
+func (c *amqpChannel) publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (confirmation, error) {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return confirm, nil
+}
+
+func New(opts *Options) (*Publisher, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, errors.Wrap(err, "unable to validate options")
+	}
+
+	p := &Publisher{
+		options: opts,
+		mtx:     &sync.Mutex{},
+	}
+
+	p.openChannel = p.openRabbitChannel
+
+	return p, nil
+}
+
+func validateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("options cannot be nil")
+	}
+
+	if opts.Rabbit == nil {
+		return errors.New("Rabbit cannot be nil")
+	}
+
+	if opts.Rabbit.Options == nil || opts.Rabbit.Options.Mode != rabbit.Producer {
+		return errors.New("Rabbit must be in producer mode")
+	}
+
+	if opts.ExchangeName == "" {
+		return errors.New("ExchangeName cannot be empty")
+	}
+
+	return nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, msgs ...*Message) ([]*Result, error) {
+	if len(msgs) == 0 {
+		return nil, errors.New("no messages to publish")
+	}
+
+	results := make([]*Result, len(msgs))
+	confirms := make([]confirmation, len(msgs))
+
+	// Publish under lock so that a batch is contiguous on the channel; confirms
+	// are waited on after releasing it.
+	returns, err := p.publishAll(ctx, msgs, results, confirms)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, confirm := range confirms {
+		if confirm == nil {
+			continue
+		}
+
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			results[i].Err = errors.Wrap(err, "unable to wait for publisher confirm")
+			continue
+		}
+
+		if !acked {
+			results[i].Err = ErrNacked
+		}
+	}
+
+	// A returned message is still acked by the broker, so it only shows up here
+	ids := make([]string, len(results))
+
+	for i, res := range results {
+		ids[i] = res.MessageID
+	}
+
+	returned := returns.collect(ids)
+
+	for _, res := range results {
+		if ret, ok := returned[res.MessageID]; ok && res.Err == nil {
+			res.Err = errors.Wrapf(ErrUnroutable, "%d %s", ret.ReplyCode, ret.ReplyText)
+		}
+	}
+
+	return results, nil
+}
+
+func (p *Publisher) publishAll(ctx context.Context, msgs []*Message, results []*Result, confirms []confirmation) (*returnTracker, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	ch, err := p.getChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range msgs {
+		if msg.MessageID == "" {
+			msg.MessageID = uuid.NewString()
+		}
+
+		results[i] = &Result{MessageID: msg.MessageID}
+
+		confirm, err := ch.publish(ctx, p.options.ExchangeName, msg.RoutingKey, amqp.Publishing{
+			Headers:      msg.Headers,
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageID,
+			Timestamp:    time.Now().UTC(),
+			AppId:        p.options.AppID,
+			Body:         msg.Body,
+		})
+		if err != nil {
+			results[i].Err = errors.Wrap(err, "unable to publish message")
+			continue
+		}
+
+		confirms[i] = confirm
+	}
+
+	return p.returns, nil
+}
+
+// getChannel returns the confirm-mode channel, (re)opening it if needed. Must
+// be called with p.mtx held.
+func (p *Publisher) getChannel() (channel, error) {
+	if p.channel != nil && !p.channel.IsClosed() {
+		return p.channel, nil
+	}
+
+	ch, err := p.openChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	p.channel = ch
+	p.returns = newReturnTracker(ch.NotifyReturn(make(chan amqp.Return)))
+
+	return ch, nil
+}
+
+func (p *Publisher) openRabbitChannel() (channel, error) {
+	r := p.options.Rabbit
+
+	if !r.ProducerRWMutex.TryRLock() {
+		return nil, ErrReconnecting
+	}
+	defer r.ProducerRWMutex.RUnlock()
+
+	if r.Conn == nil || r.Conn.IsClosed() {
+		return nil, ErrReconnecting
+	}
+
+	ch, err := r.Conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open channel")
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "unable to put channel into confirm mode")
+	}
+
+	return &amqpChannel{Channel: ch}, nil
+}
+
+// returnTracker records the messages a channel returned as unroutable, by
+// message ID. The broker sends basic.return before the ack of the same message
+// and amqp091 hands it over on the (unbuffered) returns chan before it
+// dispatches the ack, so once a confirm is in, collect() sees its return.
+type returnTracker struct {
+	returned map[string]amqp.Return
+	sync     chan struct{}
+	done     chan struct{}
+	mtx      *sync.Mutex
+}
+
+func newReturnTracker(returns <-chan amqp.Return) *returnTracker {
+	t := &returnTracker{
+		returned: make(map[string]amqp.Return),
+		sync:     make(chan struct{}),
+		done:     make(chan struct{}),
+		mtx:      &sync.Mutex{},
+	}
+
+	go t.run(returns)
+
+	return t
+}
+
+// run exits once the channel is closed (which closes returns)
+func (t *returnTracker) run(returns <-chan amqp.Return) {
+	defer close(t.done)
+
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+
+			t.mtx.Lock()
+			t.returned[ret.MessageId] = ret
+			t.mtx.Unlock()
+		case <-t.sync:
+		}
+	}
+}
+
+// collect returns (and forgets) the returns recorded for the given message
+// IDs; must be called after waiting for their confirms
+func (t *returnTracker) collect(ids []string) map[string]amqp.Return {
+	// Once run() takes the sync, it has recorded every return it received
+	select {
+	case t.sync <- struct{}{}:
+	case <-t.done:
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	found := make(map[string]amqp.Return)
+
+	for _, id := range ids {
+		if ret, ok := t.returned[id]; ok {
+			found[id] = ret
+			delete(t.returned, id)
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,13 @@
+package publisher
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPublisherSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Publisher Suite")
+}
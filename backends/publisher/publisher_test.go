@@ -0,0 +1,253 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/streamdal/rabbit"
+)
+
+var _ = Describe("Publisher", func() {
+	var (
+		p      *Publisher
+		fc     *fakeChannel
+		opened int
+	)
+
+	BeforeEach(func() {
+		opened = 0
+
+		p = &Publisher{
+			options: &Options{ExchangeName: "events", AppID: "test"},
+			mtx:     &sync.Mutex{},
+		}
+
+		p.openChannel = func() (channel, error) {
+			opened++
+			fc = newFakeChannel()
+
+			return fc, nil
+		}
+	})
+
+	Describe("validateOptions", func() {
+		producer := &rabbit.Rabbit{Options: &rabbit.Options{Mode: rabbit.Producer}}
+
+		It("should validate options", func() {
+			tests := []struct {
+				opts     *Options
+				expected string
+			}{
+				{nil, "options cannot be nil"},
+				{&Options{ExchangeName: "events"}, "Rabbit cannot be nil"},
+				{&Options{Rabbit: &rabbit.Rabbit{Options: &rabbit.Options{Mode: rabbit.Consumer}}, ExchangeName: "events"}, "producer mode"},
+				{&Options{Rabbit: &rabbit.Rabbit{}, ExchangeName: "events"}, "producer mode"},
+				{&Options{Rabbit: producer}, "ExchangeName cannot be empty"},
+				{&Options{Rabbit: producer, ExchangeName: "events"}, ""},
+			}
+
+			for _, t := range tests {
+				err := validateOptions(t.opts)
+
+				if t.expected == "" {
+					Expect(err).ToNot(HaveOccurred())
+					continue
+				}
+
+				Expect(err).To(MatchError(ContainSubstring(t.expected)))
+			}
+		})
+	})
+
+	Describe("Publish", func() {
+		It("should return results in the same order as messages", func() {
+			// Later messages are confirmed first
+			msgs := []*Message{
+				{RoutingKey: "slow", MessageID: "1"},
+				{RoutingKey: "nack"},
+				{RoutingKey: "fast", MessageID: "3"},
+			}
+
+			results, err := p.Publish(context.Background(), msgs...)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results).To(HaveLen(3))
+
+			Expect(results[0].MessageID).To(Equal("1"))
+			Expect(results[0].Err).ToNot(HaveOccurred())
+
+			Expect(results[1].MessageID).ToNot(BeEmpty())
+			Expect(results[1].MessageID).To(Equal(msgs[1].MessageID))
+			Expect(results[1].Err).To(MatchError(ErrNacked))
+
+			Expect(results[2].MessageID).To(Equal("3"))
+			Expect(results[2].Err).ToNot(HaveOccurred())
+
+			Expect(fc.published).To(Equal([]string{"1", msgs[1].MessageID, "3"}))
+		})
+
+		It("should fail unroutable messages", func() {
+			results, err := p.Publish(context.Background(),
+				&Message{RoutingKey: "fast"},
+				&Message{RoutingKey: "unroutable"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(results[0].Err).ToNot(HaveOccurred())
+			Expect(errors.Is(results[1].Err, ErrUnroutable)).To(BeTrue())
+			Expect(results[1].Err.Error()).To(ContainSubstring("312 NO_ROUTE"))
+
+			// Returns are forgotten once collected
+			Expect(p.returns.returned).To(BeEmpty())
+		})
+
+		It("should report per-message publish errors", func() {
+			results, err := p.Publish(context.Background(), &Message{RoutingKey: "error"}, &Message{RoutingKey: "fast"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(results[0].Err).To(MatchError(ContainSubstring("unable to publish message")))
+			Expect(results[1].Err).ToNot(HaveOccurred())
+		})
+
+		It("should report messages that are not confirmed in time", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			results, err := p.Publish(ctx, &Message{RoutingKey: "never"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(results[0].Err).To(MatchError(ContainSubstring("unable to wait for publisher confirm")))
+		})
+
+		It("should reuse the channel until it is closed", func() {
+			_, err := p.Publish(context.Background(), &Message{RoutingKey: "fast"})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = p.Publish(context.Background(), &Message{RoutingKey: "fast"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(1))
+
+			Expect(fc.Close()).To(Succeed())
+
+			_, err = p.Publish(context.Background(), &Message{RoutingKey: "fast"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(2))
+		})
+
+		It("should return ErrReconnecting while the backend reconnects", func() {
+			r := &rabbit.Rabbit{
+				Options:         &rabbit.Options{Mode: rabbit.Producer},
+				ProducerRWMutex: &sync.RWMutex{},
+			}
+
+			p.options.Rabbit = r
+			p.openChannel = p.openRabbitChannel
+
+			// No connection yet
+			_, err := p.Publish(context.Background(), &Message{RoutingKey: "fast"})
+			Expect(err).To(MatchError(ErrReconnecting))
+
+			// Reconnect in progress
+			r.ProducerRWMutex.Lock()
+			defer r.ProducerRWMutex.Unlock()
+
+			_, err = p.Publish(context.Background(), &Message{RoutingKey: "fast"})
+			Expect(err).To(MatchError(ErrReconnecting))
+		})
+
+		It("should reject an empty batch", func() {
+			_, err := p.Publish(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+// fakeChannel acts on the routing key: "slow" and "fast" are acked after a
+// delay, "nack" is nacked, "unroutable" is returned (and then acked, like the
+// broker does), "error" fails to publish and "never" is never confirmed
+type fakeChannel struct {
+	published []string
+	returns   []chan amqp.Return
+	closed    bool
+	mtx       sync.Mutex
+}
+
+type fakeConfirmation struct {
+	acked bool
+	delay time.Duration
+}
+
+func (f *fakeConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	select {
+	case <-time.After(f.delay):
+		return f.acked, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{
+		published: make([]string, 0),
+		returns:   make([]chan amqp.Return, 0),
+	}
+}
+
+func (f *fakeChannel) publish(_ context.Context, _, key string, msg amqp.Publishing) (confirmation, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.published = append(f.published, msg.MessageId)
+
+	switch key {
+	case "error":
+		return nil, errors.New("channel/connection is not open")
+	case "slow":
+		return &fakeConfirmation{acked: true, delay: 50 * time.Millisecond}, nil
+	case "nack":
+		return &fakeConfirmation{acked: false, delay: 10 * time.Millisecond}, nil
+	case "never":
+		return &fakeConfirmation{acked: true, delay: time.Hour}, nil
+	case "unroutable":
+		// Like amqp091, the return is handed over before the ack
+		for _, c := range f.returns {
+			c <- amqp.Return{ReplyCode: 312, ReplyText: "NO_ROUTE", RoutingKey: key, MessageId: msg.MessageId}
+		}
+	}
+
+	return &fakeConfirmation{acked: true}, nil
+}
+
+func (f *fakeChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.returns = append(f.returns, c)
+
+	return c
+}
+
+func (f *fakeChannel) IsClosed() bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.closed
+}
+
+func (f *fakeChannel) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if !f.closed {
+		f.closed = true
+
+		for _, c := range f.returns {
+			close(c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package rabbitinfo is used for inspecting the state of a rabbit backend
+// (connection, channel, queue depth) without going through the management API.
+package rabbitinfo
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/streamdal/rabbit"
+
+	"github.com/streamdal/go-svc-template/config"
+)
+
+var (
+	// ErrReconnecting is returned when the rabbit lib is in the middle of
+	// re-establishing its connection
+	ErrReconnecting = errors.New("rabbit backend is reconnecting")
+
+	// ErrNotInspectable is returned when the backend is not a *rabbit.Rabbit
+	ErrNotInspectable = errors.New("rabbit backend cannot be inspected")
+)
+
+type State struct {
+	Connected    bool `json:"connected"`
+	ChannelOpen  bool `json:"channel_open"`
+	Reconnecting bool `json:"reconnecting"`
+}
+
+// Broker describes the broker a rabbit backend is connected to
+type Broker struct {
+	State
+
+	// URL is the (redacted) entry of rabbit.Options.URLs we are connected to;
+	// empty if it cannot be determined (see RemoteAddr)
+	URL        string `json:"url,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// LastReconnectAt is only known if the backend's logger implements
+	// ReconnectTracker; nil if it never reconnected
+	LastReconnectAt *time.Time `json:"last_reconnect_at,omitempty"`
+}
+
+// ReconnectTracker is implemented by rabbit.Logger implementations that keep
+// track of reconnects (the rabbit lib has no other hook for them)
+type ReconnectTracker interface {
+	LastReconnect() time.Time
+}
+
+type Queue struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+}
+
+// GetState returns the connection + channel state of a rabbit backend. The
+// rabbit lib holds the consumer lock (for writing) for the entire duration of
+// a reconnect - if we cannot grab a read lock, we are reconnecting.
+func GetState(r rabbit.IRabbit) *State {
+	rr, ok := r.(*rabbit.Rabbit)
+	if !ok {
+		// Not something we know how to inspect (ie. a fake in tests)
+		return &State{Connected: true, ChannelOpen: true}
+	}
+
+	if !rr.ConsumerRWMutex.TryRLock() {
+		return &State{Reconnecting: true}
+	}
+	defer rr.ConsumerRWMutex.RUnlock()
+
+	return &State{
+		Connected:   rr.Conn != nil && !rr.Conn.IsClosed(),
+		ChannelOpen: rr.ProducerServerChannel != nil && !rr.ProducerServerChannel.IsClosed(),
+	}
+}
+
+// GetBroker returns the state of a rabbit backend along with the broker it is
+// connected to
+func GetBroker(r rabbit.IRabbit) *Broker {
+	broker := &Broker{State: *GetState(r)}
+
+	rr, ok := r.(*rabbit.Rabbit)
+	if !ok || rr.Options == nil {
+		return broker
+	}
+
+	if t, ok := rr.Options.Log.(ReconnectTracker); ok {
+		if last := t.LastReconnect(); !last.IsZero() {
+			broker.LastReconnectAt = &last
+		}
+	}
+
+	if broker.Reconnecting || !broker.Connected {
+		return broker
+	}
+
+	// Conn is swapped during reconnects; we are not reconnecting, but still
+	// need the lock to read it safely
+	if !rr.ConsumerRWMutex.TryRLock() {
+		broker.Reconnecting = true
+		return broker
+	}
+
+	var remote net.Addr
+
+	if rr.Conn != nil {
+		remote = rr.Conn.RemoteAddr()
+	}
+
+	rr.ConsumerRWMutex.RUnlock()
+
+	if remote == nil {
+		return broker
+	}
+
+	broker.RemoteAddr = remote.String()
+	broker.URL = config.RedactURL(connectedURL(rr.Options.URLs, broker.RemoteAddr, rr.Options.UseTLS))
+
+	return broker
+}
+
+// connectedURL picks the URL we are connected to by comparing hosts against
+// the connection's remote address. Hostnames are not resolved, so with
+// multiple URLs using hostnames, "" is returned.
+func connectedURL(urls []string, remoteAddr string, useTLS bool) string {
+	if len(urls) == 1 {
+		return urls[0]
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+
+		port := u.Port()
+
+		if port == "" {
+			port = "5672"
+
+			if useTLS || u.Scheme == "amqps" {
+				port = "5671"
+			}
+		}
+
+		if net.JoinHostPort(u.Hostname(), port) == remoteAddr {
+			return raw
+		}
+	}
+
+	return ""
+}
+
+// QueueName returns the name of the queue the backend consumes from
+func QueueName(r rabbit.IRabbit) string {
+	rr, ok := r.(*rabbit.Rabbit)
+	if !ok || rr.Options == nil {
+		return ""
+	}
+
+	return rr.Options.QueueName
+}
+
+// InspectQueue fetches the message + consumer count of the backend's queue via
+// a passive declare. A dedicated, short-lived channel is used since a failed
+// passive declare closes the channel it was issued on.
+func InspectQueue(r rabbit.IRabbit) (*Queue, error) {
+	rr, ok := r.(*rabbit.Rabbit)
+	if !ok {
+		return nil, ErrNotInspectable
+	}
+
+	if !rr.ConsumerRWMutex.TryRLock() {
+		return nil, ErrReconnecting
+	}
+	defer rr.ConsumerRWMutex.RUnlock()
+
+	if rr.Conn == nil || rr.Conn.IsClosed() {
+		return nil, errors.New("rabbit connection is closed")
+	}
+
+	ch, err := rr.Conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open inspection channel")
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(
+		rr.Options.QueueName,
+		rr.Options.QueueDurable,
+		rr.Options.QueueAutoDelete,
+		rr.Options.QueueExclusive,
+		false,
+		rr.Options.QueueArgs,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to inspect queue '%s'", rr.Options.QueueName)
+	}
+
+	return &Queue{
+		Name:      q.Name,
+		Messages:  q.Messages,
+		Consumers: q.Consumers,
+	}, nil
+}
@@ -0,0 +1,13 @@
+package rabbitinfo
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRabbitinfoSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Rabbitinfo Suite")
+}
@@ -0,0 +1,153 @@
+// Package buildinfo collects build metadata from the Go toolchain
+// (runtime/debug.ReadBuildInfo) and from values injected via ldflags, ie.:
+//
+//	-ldflags "-X github.com/streamdal/go-svc-template/buildinfo.BuildTime=2024-06-11T10:00:00Z"
+package buildinfo
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Set via ldflags; Revision is only needed if the binary is built without VCS
+// info (ie. in a Docker build without .git)
+var (
+	BuildTime string
+	Revision  string
+)
+
+// startTime is the (approximate) process start time
+var startTime = time.Now()
+
+type Dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+type Info struct {
+	Service   string `json:"service"`
+	Env       string `json:"env"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Dirty     bool   `json:"dirty"`
+	VCSTime   string `json:"vcs_time,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module"`
+
+	StartTime time.Time `json:"start_time"`
+	UptimeSec int64     `json:"uptime_sec"`
+
+	Dependencies []*Dependency `json:"dependencies"`
+}
+
+// Get returns the build info for the running binary along with the given
+// service name, env and version (which is set via ldflags in main)
+func Get(service, env, version string) *Info {
+	info := &Info{
+		Service:      service,
+		Env:          env,
+		Version:      version,
+		Revision:     Revision,
+		BuildTime:    BuildTime,
+		GoVersion:    runtime.Version(),
+		StartTime:    startTime,
+		UptimeSec:    int64(time.Since(startTime).Seconds()),
+		Dependencies: make([]*Dependency, 0),
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Module = bi.Main.Path
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			// ldflags take precedence; they are set explicitly
+			if info.Revision == "" {
+				info.Revision = s.Value
+			}
+		case "vcs.modified":
+			info.Dirty = s.Value == "true"
+		case "vcs.time":
+			info.VCSTime = s.Value
+		}
+	}
+
+	for _, d := range bi.Deps {
+		dep := &Dependency{
+			Path:    d.Path,
+			Version: d.Version,
+		}
+
+		if d.Replace != nil {
+			dep.Replace = strings.TrimSpace(d.Replace.Path + " " + d.Replace.Version)
+		}
+
+		info.Dependencies = append(info.Dependencies, dep)
+	}
+
+	sort.Slice(info.Dependencies, func(i, j int) bool {
+		return info.Dependencies[i].Path < info.Dependencies[j].Path
+	})
+
+	return info
+}
+
+// WriteText writes the info in a human friendly format
+func (i *Info) WriteText(w io.Writer) error {
+	revision := i.Revision
+	if i.Dirty {
+		revision += " (dirty)"
+	}
+
+	lines := [][2]string{
+		{"service", i.Service},
+		{"env", i.Env},
+		{"version", i.Version},
+		{"revision", revision},
+		{"vcs time", i.VCSTime},
+		{"build time", i.BuildTime},
+		{"go version", i.GoVersion},
+		{"module", i.Module},
+		{"start time", i.StartTime.UTC().Format(time.RFC3339)},
+		{"uptime", (time.Duration(i.UptimeSec) * time.Second).String()},
+	}
+
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(w, "%-12s %s\n", l[0]+":", l[1]); err != nil {
+			return err
+		}
+	}
+
+	if len(i.Dependencies) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintln(w, "dependencies:"); err != nil {
+		return err
+	}
+
+	for _, d := range i.Dependencies {
+		line := "  " + d.Path + " " + d.Version
+
+		if d.Replace != "" {
+			line += " => " + d.Replace
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
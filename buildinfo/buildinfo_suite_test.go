@@ -0,0 +1,13 @@
+package buildinfo
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuildinfoSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Buildinfo Suite")
+}
@@ -0,0 +1,56 @@
+package buildinfo
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buildinfo", func() {
+	AfterEach(func() {
+		BuildTime = ""
+		Revision = ""
+	})
+
+	Describe("Get", func() {
+		It("should include config, runtime and ldflags values", func() {
+			BuildTime = "2024-06-11T10:00:00Z"
+			Revision = "abcdef12"
+
+			info := Get("svc", "prod", "v1.2.3")
+
+			Expect(info.Service).To(Equal("svc"))
+			Expect(info.Env).To(Equal("prod"))
+			Expect(info.Version).To(Equal("v1.2.3"))
+			Expect(info.BuildTime).To(Equal("2024-06-11T10:00:00Z"))
+			Expect(info.Revision).To(Equal("abcdef12"))
+			Expect(info.GoVersion).To(HavePrefix("go"))
+			Expect(info.StartTime).To(Equal(startTime))
+			Expect(info.UptimeSec).To(BeNumerically(">=", 0))
+		})
+	})
+
+	Describe("WriteText", func() {
+		It("should render one line per value and the dependencies", func() {
+			info := &Info{
+				Service:  "svc",
+				Version:  "v1.2.3",
+				Revision: "abcdef12",
+				Dirty:    true,
+				Dependencies: []*Dependency{
+					{Path: "github.com/foo/bar", Version: "v1.0.0"},
+					{Path: "github.com/foo/baz", Version: "v0.1.0", Replace: "../baz"},
+				},
+			}
+
+			buf := &bytes.Buffer{}
+			Expect(info.WriteText(buf)).To(Succeed())
+
+			Expect(buf.String()).To(ContainSubstring("version:     v1.2.3\n"))
+			Expect(buf.String()).To(ContainSubstring("revision:    abcdef12 (dirty)\n"))
+			Expect(buf.String()).To(ContainSubstring("dependencies:\n  github.com/foo/bar v1.0.0\n"))
+			Expect(buf.String()).To(ContainSubstring("github.com/foo/baz v0.1.0 => ../baz"))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package clog
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // This package is a simple wrapper around zap.Logger that supports including
@@ -11,6 +12,9 @@ import (
 // This allows us to include "top-level" attributes like "env", "pkg", "method",
 // etc. into all log messages without having to tweak/adjust the zap's core or
 // logger.
+//
+// Loggers created via NewWithLevels also consult a LevelController so that the
+// level can be changed at runtime, per "pkg" field.
 
 type ICustomLog interface {
 	Debug(msg string, fields ...zap.Field)
@@ -24,41 +28,84 @@ type ICustomLog interface {
 type CustomLog struct {
 	fields []zap.Field
 	logger *zap.Logger
+	levels *LevelController
+	pkg    string
 }
 
 func New(logger *zap.Logger, fields ...zap.Field) ICustomLog {
+	return NewWithLevels(logger, nil, fields...)
+}
+
+// NewWithLevels returns a logger that filters messages using the levels set on
+// levels for the logger's "pkg" field; a nil levels disables filtering.
+func NewWithLevels(logger *zap.Logger, levels *LevelController, fields ...zap.Field) ICustomLog {
 	tmpFields := make([]zap.Field, 0)
 
 	if logger == nil {
 		logger = zap.NewNop()
 	}
 
-	return &CustomLog{
+	c := &CustomLog{
 		logger: logger,
+		levels: levels,
 		fields: append(tmpFields, fields...),
 	}
+
+	// The last "pkg" field wins, same as in the encoded output
+	for _, f := range c.fields {
+		if f.Key == "pkg" && f.Type == zapcore.StringType {
+			c.pkg = f.String
+		}
+	}
+
+	if levels != nil && c.pkg != "" {
+		levels.register(c.pkg)
+	}
+
+	return c
+}
+
+func (c CustomLog) enabled(lvl zapcore.Level) bool {
+	return c.levels == nil || c.levels.EnabledFor(c.pkg, lvl)
 }
 
 func (c CustomLog) Debug(msg string, fields ...zap.Field) {
+	if !c.enabled(zapcore.DebugLevel) {
+		return
+	}
+
 	fields = append(c.fields, fields...)
 	c.logger.Debug(msg, fields...)
 }
 
 func (c CustomLog) Info(msg string, fields ...zap.Field) {
+	if !c.enabled(zapcore.InfoLevel) {
+		return
+	}
+
 	fields = append(c.fields, fields...)
 	c.logger.Info(msg, fields...)
 }
 
 func (c CustomLog) Warn(msg string, fields ...zap.Field) {
+	if !c.enabled(zapcore.WarnLevel) {
+		return
+	}
+
 	fields = append(c.fields, fields...)
 	c.logger.Warn(msg, fields...)
 }
 
 func (c CustomLog) Error(msg string, fields ...zap.Field) {
+	if !c.enabled(zapcore.ErrorLevel) {
+		return
+	}
+
 	fields = append(c.fields, fields...)
 	c.logger.Error(msg, fields...)
 }
 
+// Fatal is never filtered since it exits the process
 func (c CustomLog) Fatal(msg string, fields ...zap.Field) {
 	fields = append(c.fields, fields...)
 	c.logger.Fatal(msg, fields...)
@@ -66,5 +113,5 @@ func (c CustomLog) Fatal(msg string, fields ...zap.Field) {
 
 func (c CustomLog) With(fields ...zap.Field) ICustomLog {
 	fields = append(c.fields, fields...)
-	return New(c.logger, fields...)
+	return NewWithLevels(c.logger, c.levels, fields...)
 }
@@ -0,0 +1,13 @@
+package clog
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestClogSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clog Suite")
+}
@@ -0,0 +1,19 @@
+package clog
+
+import (
+	"context"
+)
+
+type ctxKey struct{}
+
+// WithContext returns a copy of ctx that carries the given logger; use it for
+// request-scoped loggers (ie. loggers that include a request ID).
+func WithContext(ctx context.Context, log ICustomLog) context.Context {
+	return context.WithValue(ctx, ctxKey{}, log)
+}
+
+// FromContext returns the logger stored in ctx via WithContext()
+func FromContext(ctx context.Context) (ICustomLog, bool) {
+	log, ok := ctx.Value(ctxKey{}).(ICustomLog)
+	return log, ok
+}
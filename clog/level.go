@@ -0,0 +1,204 @@
+package clog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelController holds the default log level and temporary per-pkg
+// overrides. Overrides always have a TTL and revert automatically so that a
+// live pod is never left on debug by accident.
+//
+// The zap core should use the controller as its LevelEnabler (so that it lets
+// through the most verbose level in use); CustomLog then filters by the level
+// of its "pkg" field.
+type LevelController struct {
+	base      zap.AtomicLevel
+	min       zap.AtomicLevel
+	overrides map[string]*levelOverride
+	known     map[string]struct{}
+	mtx       *sync.RWMutex
+}
+
+type levelOverride struct {
+	level     zapcore.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+// LevelOverride is a temporary level for a pkg; an empty Pkg overrides the
+// default level
+type LevelOverride struct {
+	Pkg       string    `json:"pkg"`
+	Level     string    `json:"level"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type LevelState struct {
+	Default   string           `json:"default"`
+	Overrides []*LevelOverride `json:"overrides"`
+
+	// Pkgs are the pkg names that loggers have been created for
+	Pkgs []string `json:"pkgs"`
+}
+
+func NewLevelController(base zapcore.Level) *LevelController {
+	return &LevelController{
+		base:      zap.NewAtomicLevelAt(base),
+		min:       zap.NewAtomicLevelAt(base),
+		overrides: make(map[string]*levelOverride),
+		known:     make(map[string]struct{}),
+		mtx:       &sync.RWMutex{},
+	}
+}
+
+// Enabled satisfies zapcore.LevelEnabler; true if any pkg logs at lvl
+func (l *LevelController) Enabled(lvl zapcore.Level) bool {
+	return l.min.Enabled(lvl)
+}
+
+// EnabledFor returns true if a logger for pkg should log at lvl
+func (l *LevelController) EnabledFor(pkg string, lvl zapcore.Level) bool {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	if o, ok := l.overrides[pkg]; ok {
+		return o.level.Enabled(lvl)
+	}
+
+	if o, ok := l.overrides[""]; ok {
+		return o.level.Enabled(lvl)
+	}
+
+	return l.base.Enabled(lvl)
+}
+
+// SetDefault changes the default level (ie. on config reload); overrides
+// made via SetLevel() are kept
+func (l *LevelController) SetDefault(level zapcore.Level) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.base.SetLevel(level)
+	l.updateMin()
+}
+
+// SetLevel overrides the level for pkg ("" = default level) until ttl passes
+func (l *LevelController) SetLevel(pkg string, level zapcore.Level, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if o, ok := l.overrides[pkg]; ok {
+		o.timer.Stop()
+	}
+
+	o := &levelOverride{
+		level:     level,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	o.timer = time.AfterFunc(ttl, func() {
+		l.revert(pkg, o)
+	})
+
+	l.overrides[pkg] = o
+	l.updateMin()
+
+	return nil
+}
+
+// Reset removes the override for pkg ("" = default level); returns false if
+// there was none
+func (l *LevelController) Reset(pkg string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	o, ok := l.overrides[pkg]
+	if !ok {
+		return false
+	}
+
+	o.timer.Stop()
+	delete(l.overrides, pkg)
+	l.updateMin()
+
+	return true
+}
+
+// revert removes an expired override unless it has been replaced since
+func (l *LevelController) revert(pkg string, o *levelOverride) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.overrides[pkg] != o {
+		return
+	}
+
+	delete(l.overrides, pkg)
+	l.updateMin()
+}
+
+// updateMin must be called with l.mtx held
+func (l *LevelController) updateMin() {
+	min := l.base.Level()
+
+	for _, o := range l.overrides {
+		if o.level < min {
+			min = o.level
+		}
+	}
+
+	l.min.SetLevel(min)
+}
+
+// State returns the default level, active overrides and known pkgs
+func (l *LevelController) State() *LevelState {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	state := &LevelState{
+		Default:   l.base.Level().String(),
+		Overrides: make([]*LevelOverride, 0, len(l.overrides)),
+		Pkgs:      make([]string, 0, len(l.known)),
+	}
+
+	for pkg, o := range l.overrides {
+		state.Overrides = append(state.Overrides, &LevelOverride{
+			Pkg:       pkg,
+			Level:     o.level.String(),
+			ExpiresAt: o.expiresAt,
+		})
+	}
+
+	for pkg := range l.known {
+		state.Pkgs = append(state.Pkgs, pkg)
+	}
+
+	sort.Slice(state.Overrides, func(i, j int) bool { return state.Overrides[i].Pkg < state.Overrides[j].Pkg })
+	sort.Strings(state.Pkgs)
+
+	return state
+}
+
+func (l *LevelController) register(pkg string) {
+	l.mtx.RLock()
+	_, ok := l.known[pkg]
+	l.mtx.RUnlock()
+
+	if ok {
+		return
+	}
+
+	l.mtx.Lock()
+	l.known[pkg] = struct{}{}
+	l.mtx.Unlock()
+}
@@ -0,0 +1,115 @@
+package clog
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var _ = Describe("LevelController", func() {
+	var (
+		levels *LevelController
+		logs   *observer.ObservedLogs
+		log    ICustomLog
+	)
+
+	BeforeEach(func() {
+		levels = NewLevelController(zapcore.InfoLevel)
+
+		var core zapcore.Core
+		core, logs = observer.New(levels)
+
+		log = NewWithLevels(zap.New(core), levels, zap.String("env", "test"))
+	})
+
+	It("should use the default level", func() {
+		log.With(zap.String("pkg", "proc")).Debug("hidden")
+		log.With(zap.String("pkg", "proc")).Info("shown")
+
+		Expect(logs.Len()).To(Equal(1))
+		Expect(logs.All()[0].Message).To(Equal("shown"))
+	})
+
+	It("should only enable an override for the given pkg", func() {
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, time.Minute)).To(Succeed())
+
+		log.With(zap.String("pkg", "proc")).Debug("proc debug")
+		log.With(zap.String("pkg", "api")).Debug("api debug")
+		log.Debug("no pkg debug")
+
+		Expect(logs.Len()).To(Equal(1))
+		Expect(logs.All()[0].Message).To(Equal("proc debug"))
+	})
+
+	It("should override the default level with an empty pkg", func() {
+		Expect(levels.SetLevel("", zapcore.ErrorLevel, time.Minute)).To(Succeed())
+
+		log.With(zap.String("pkg", "api")).Warn("hidden")
+		log.Error("shown")
+
+		Expect(logs.Len()).To(Equal(1))
+	})
+
+	It("should revert once the TTL passes", func() {
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, 50*time.Millisecond)).To(Succeed())
+		Expect(levels.Enabled(zapcore.DebugLevel)).To(BeTrue())
+
+		Eventually(func() bool {
+			return levels.EnabledFor("proc", zapcore.DebugLevel)
+		}).Should(BeFalse())
+
+		Expect(levels.Enabled(zapcore.DebugLevel)).To(BeFalse())
+		Expect(levels.State().Overrides).To(BeEmpty())
+	})
+
+	It("should keep a replaced override when the old TTL passes", func() {
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, 50*time.Millisecond)).To(Succeed())
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, time.Minute)).To(Succeed())
+
+		Consistently(func() bool {
+			return levels.EnabledFor("proc", zapcore.DebugLevel)
+		}, 150*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should reset overrides", func() {
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, time.Minute)).To(Succeed())
+
+		Expect(levels.Reset("proc")).To(BeTrue())
+		Expect(levels.Reset("proc")).To(BeFalse())
+		Expect(levels.EnabledFor("proc", zapcore.DebugLevel)).To(BeFalse())
+	})
+
+	It("should change the default level but keep overrides", func() {
+		Expect(levels.SetLevel("proc", zapcore.WarnLevel, time.Minute)).To(Succeed())
+
+		levels.SetDefault(zapcore.DebugLevel)
+
+		Expect(levels.Enabled(zapcore.DebugLevel)).To(BeTrue())
+		Expect(levels.EnabledFor("api", zapcore.DebugLevel)).To(BeTrue())
+		Expect(levels.EnabledFor("proc", zapcore.InfoLevel)).To(BeFalse())
+		Expect(levels.State().Default).To(Equal("debug"))
+	})
+
+	It("should reject a non-positive TTL", func() {
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, 0)).ToNot(Succeed())
+	})
+
+	It("should report state and known pkgs", func() {
+		log.With(zap.String("pkg", "proc"))
+		log.With(zap.String("pkg", "api"))
+
+		Expect(levels.SetLevel("proc", zapcore.DebugLevel, time.Minute)).To(Succeed())
+
+		state := levels.State()
+
+		Expect(state.Default).To(Equal("info"))
+		Expect(state.Pkgs).To(Equal([]string{"api", "proc"}))
+		Expect(state.Overrides).To(HaveLen(1))
+		Expect(state.Overrides[0].Pkg).To(Equal("proc"))
+		Expect(state.Overrides[0].Level).To(Equal("debug"))
+	})
+})
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+
 	"github.com/alecthomas/kong"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
@@ -14,23 +16,102 @@ const (
 
 type Config struct {
 	Version          kong.VersionFlag `help:"Show version and exit" short:"v" env:"-"`
+	DumpConfig       bool             `help:"Print the effective (redacted) config and exit." env:"-"`
+	ConfigFiles      []string         `kong:"name='config',help='YAML or JSON config file(s); later files override earlier ones. Flags and env vars override config files.',placeholder='FILE'"`
 	EnvName          string           `kong:"help='Environment name.',default='dev'"`
 	ServiceName      string           `kong:"help='Service name.',default='go-svc-template'"`
 	HealthFreqSec    int              `kong:"help='Health check frequency in seconds.',default=10"`
 	EnablePprof      bool             `kong:"help='Enable pprof endpoints (http://$apiListenAddress/debug).',default=false"`
 	APIListenAddress string           `kong:"help='API listen address (serves health, metrics, version).',default=:8080"`
 	LogConfig        string           `kong:"help='Logging config to use.',enum='dev,prod',default='dev'"`
+	LogLevel         string           `kong:"help='Default log level: debug, info, warn or error (defaults to debug for the dev logging config and info otherwise).'" reload:"true"`
+	UnknownEnvAction string           `kong:"help='What to do about GO_SVC_TEMPLATE_* env vars that do not match any setting (ie. typos).',enum='ignore,warn,fail',default='warn'"`
+
+	LogLevelDefaultTTLSec int `kong:"help='How long a log level change made via the admin API lasts if no TTL is given.',default=900"`
+	LogLevelMaxTTLSec     int `kong:"help='Maximum TTL for log level changes made via the admin API.',default=14400"`
+
+	Auth   AuthConfig `kong:"embed"`
+	APITLS TLSConfig  `kong:"embed,prefix='api-'"`
+
+	AdminListenAddress string     `kong:"help='Optional separate listen address for admin, debug, metrics and probe routes (served on the API listener if not set).'"`
+	AdminListenerAuth  AuthConfig `kong:"embed,prefix='admin-listener-'"`
+	AdminListenerTLS   TLSConfig  `kong:"embed,prefix='admin-listener-'"`
+
+	GRPCListenAddress string    `kong:"help='Optional gRPC listen address (serves grpc.health.v1 and registered services; disabled if not set).'"`
+	GRPCReflection    bool      `kong:"help='Enable gRPC server reflection.',default=true"`
+	GRPCTLS           TLSConfig `kong:"embed,prefix='grpc-'"`
+
+	PprofRole string `kong:"help='Role required to access pprof endpoints.',enum='public,operator,admin',default='operator'"`
+
+	HTTPReadTimeoutSec        int              `kong:"help='Maximum duration for reading an entire HTTP request, including the body, in seconds (0 = no timeout).',default=30"`
+	HTTPReadHeaderTimeoutSec  int              `kong:"help='Maximum duration for reading HTTP request headers in seconds.',default=10"`
+	HTTPWriteTimeoutSec       int              `kong:"help='Maximum duration before timing out writes of an HTTP response in seconds (0 = no timeout).',default=60"`
+	HTTPIdleTimeoutSec        int              `kong:"help='Maximum time to wait for the next request on a keep-alive connection in seconds.',default=120"`
+	HTTPMaxHeaderBytes        int              `kong:"help='Maximum size of HTTP request headers in bytes.',default=1048576"`
+	HTTPMaxBodyBytes          int64            `kong:"help='Default maximum size of HTTP request bodies in bytes (0 = unlimited).',default=1048576"`
+	HTTPRouteMaxBodyBytes     map[string]int64 `kong:"help='Per-route body limits (route=bytes;...) that override the default; the route is the pattern, ie. /admin/cache/items/*key.'"`
+	HTTPMaxConns              int              `kong:"help='Maximum number of concurrent connections per HTTP listener (0 = unlimited).',default=0"`
+	HTTP2Cleartext            bool             `kong:"help='Serve HTTP/2 without TLS (h2c) on listeners that do not use TLS.',default=false"`
+	HTTP2MaxConcurrentStreams uint32           `kong:"help='Maximum number of concurrent HTTP/2 streams per connection.',default=250"`
+	HTTP2MaxReadFrameSize     uint32           `kong:"help='Maximum HTTP/2 frame size the server is willing to read in bytes (0 = default of 1MB).',default=0"`
+
+	RateLimitEnabled           bool              `kong:"help='Enable per-client rate limiting of HTTP routes.',default=false" reload:"true"`
+	RateLimitKey               string            `kong:"help='What identifies a client: ip, token (the verified bearer token, HMAC key or client certificate; falls back to ip) or header (falls back to ip).',enum='ip,token,header',default='ip'" reload:"true"`
+	RateLimitHeader            string            `kong:"help='Header that identifies a client when rate-limit-key is header.',default='X-Client-ID'" reload:"true"`
+	RateLimitTrustForwardedFor bool              `kong:"help='Take the client IP from X-Forwarded-For (only enable behind proxies that append to it).',default=false" reload:"true"`
+	RateLimitForwardedForHops  int               `kong:"help='Number of trusted proxies that append to X-Forwarded-For; the client IP is the entry this many positions from the right.',default=1" reload:"true"`
+	RateLimitDefault           string            `kong:"help='Default limit per client and route as <requests>/<window>.',default='600/1m'" reload:"true"`
+	RateLimitRoutes            map[string]string `kong:"help='Per-route limits (route=<requests>/<window>;...) that override the default; the route is the pattern, ie. /v1/publish=60/1m. A limit of 0 disables limiting.'" reload:"true"`
+	RateLimitExcludeRoutes     []string          `kong:"help='Routes that are never rate limited.',default='/health,/health-check,/live,/ready,/startup,/metrics'" reload:"true"`
+	RateLimitStore             string            `kong:"help='Where counters are kept: memory (per pod) or cache (the cache backend).',enum='memory,cache',default='memory'"`
+
+	AccessLogEnabled      bool     `kong:"help='Log every HTTP request.',default=true"`
+	AccessLogExcludePaths []string `kong:"help='Paths (or gRPC methods) that are not access logged (ie. probes).',default='/live,/ready,/startup,/metrics,/grpc.health.v1.Health/Check,/grpc.health.v1.Health/Watch'"`
+
+	CORSAllowedOrigins   []string `kong:"help='Origins allowed to make cross-origin requests (CORS is disabled if not set; * allows any).'"`
+	CORSAllowedMethods   []string `kong:"help='Methods allowed in cross-origin requests.',default='GET,POST,PUT,DELETE,OPTIONS'"`
+	CORSAllowedHeaders   []string `kong:"help='Headers allowed in cross-origin requests.',default='Authorization,Content-Type,X-Request-ID'"`
+	CORSAllowCredentials bool     `kong:"help='Allow credentials in cross-origin requests (only for listed origins; cannot be combined with *).',default=false"`
+	CORSMaxAgeSec        int      `kong:"help='How long browsers may cache preflight responses in seconds.',default=600"`
+
+	HealthRabbitFatal         bool `kong:"help='Whether a failing rabbit health check is fatal (fails liveness).',default=false"`
+	HealthRabbitIntervalSec   int  `kong:"help='Rabbit health check interval in seconds (0 = use health-freq-sec).',default=0"`
+	HealthRabbitInspectQueue  bool `kong:"help='Whether the rabbit health check should also fetch queue depth (via passive declare).',default=false" reload:"true"`
+	HealthCacheFatal          bool `kong:"help='Whether a failing cache health check is fatal (fails liveness).',default=false"`
+	HealthCacheIntervalSec    int  `kong:"help='Cache health check interval in seconds (0 = use health-freq-sec).',default=0"`
+	HealthConsumerFatal       bool `kong:"help='Whether a failing consumer watchdog check is fatal (fails liveness).',default=false"`
+	HealthConsumerIntervalSec int  `kong:"help='Consumer watchdog check interval in seconds (0 = use health-freq-sec).',default=0"`
+	HealthConsumerStallSec    int  `kong:"help='Consumer watchdog fails if a group with a non-empty queue has not made progress for this many seconds.',default=60" reload:"true"`
+
+	HealthTLSFatal         bool `kong:"help='Whether a failing TLS certificate check is fatal (fails liveness).',default=false"`
+	HealthTLSIntervalSec   int  `kong:"help='TLS certificate check interval in seconds (0 = use health-freq-sec).',default=0"`
+	HealthTLSExpiryWarnSec int  `kong:"help='Report TLS certificates that expire within this many seconds as expiring soon in the health details.',default=604800" reload:"true"`
+
+	HealthWebhookURLs        []string `kong:"name='health-webhook-urls',help='URL(s) to POST health check transition notifications to.'" redact:"endpoint"`
+	HealthWebhookSecret      string   `kong:"help='Secret used for signing health webhook requests (HMAC-SHA256 of <timestamp>.<body>, sent in X-Signature-256).'" redact:"true"`
+	HealthWebhookDebounceSec int      `kong:"help='Only notify about a check once its state has been stable for this many seconds.',default=30"`
+	HealthWebhookTimeoutSec  int      `kong:"help='Timeout for health webhook requests in seconds.',default=5"`
+
+	TelemetryProvider string `kong:"help='Tracing + metrics provider.',enum='none,newrelic,otel',default='newrelic'"`
 
 	NewRelicAppName    string `kong:"help='New Relic application name.',default='go-svc-template (DEV)'"`
-	NewRelicLicenseKey string `kong:"help='New Relic license key.'"`
+	NewRelicLicenseKey string `kong:"help='New Relic license key.'" redact:"true"`
+
+	OtelExporter       string            `kong:"help='OpenTelemetry exporter.',enum='otlp,stdout,file',default='otlp'"`
+	OtelEndpoint       string            `kong:"help='OpenTelemetry OTLP/gRPC collector endpoint (host:port).',default='localhost:4317'"`
+	OtelInsecure       bool              `kong:"help='Disable TLS when talking to the OTLP collector.',default=false"`
+	OtelHeaders        map[string]string `kong:"help='Additional headers to send to the OTLP collector (ie. api-key=1234).'" redact:"true"`
+	OtelFilePath       string            `kong:"help='File to write spans + metrics to when using the file exporter.',default='otel.json'"`
+	OtelSampleRatio    float64           `kong:"help='Ratio of traces to sample (0..1).',default=1"`
+	OtelMetricInterval int               `kong:"help='How often to export metrics (in seconds).',default=30"`
 
-	RabbitURL               []string `kong:"help='RabbitMQ server URL(s).',default=amqp://localhost"`
+	RabbitURL               []string `kong:"help='RabbitMQ server URL(s).',default=amqp://localhost" redact:"url"`
 	RabbitExchangeName      string   `kong:"help='RabbitMQ exchange name',default=events"`
 	RabbitExchangeDeclare   bool     `kong:"help='Whether to declare/create exchange if it does not already exist.',default=true"`
 	RabbitExchangeDurable   bool     `kong:"help='Whether exchange should survive a RabbitMQ server restart.',default=true"`
 	RabbitBindingKeys       []string `kong:"help='Bind the following routing-keys to the queue-name.',default='data-proc'"`
 	RabbitQueueName         string   `kong:"help='RabbitMQ queue name.',default='data-proc'"`
-	RabbitNumConsumers      int      `kong:"help='Number of RabbitMQ consumers.',default=4"`
+	RabbitNumConsumers      int      `kong:"help='Number of RabbitMQ consumers.',default=4" reload:"true"`
 	RabbitRetryReconnectSec int      `kong:"help='Interval used for re-connecting to Rabbit (when it goes away).',default=10"`
 	RabbitAutoAck           bool     `kong:"help='Whether to auto-ACK consumed messages. You probably do not want this.',default=false"`
 	RabbitQueueDeclare      bool     `kong:"help='Whether to declare/create queue if it does not already exist.',default=true"`
@@ -40,18 +121,119 @@ type Config struct {
 	RabbitUseTLS            bool     `kong:"help='RabbitMQ use TLS.',default=false,short='t'"`
 	RabbitSkipVerifyTLS     bool     `kong:"help='RabbitMQ skip TLS verification.',default=false"`
 
+	TailEnabled        bool `kong:"help='Enable the live tail of consumed messages (GET /admin/proc/tail; requires admin credentials). Exposes message bodies, so you probably only want this outside of prod.',default=false" reload:"true"`
+	TailMaxSubscribers int  `kong:"help='Maximum number of concurrent live tail streams.',default=3"`
+	TailBufferSize     int  `kong:"help='Number of events buffered per live tail stream before events are dropped.',default=100"`
+	TailMaxBodyBytes   int  `kong:"help='Message bodies are truncated to this many bytes in the live tail.',default=1024"`
+	TailMaxDurationSec int  `kong:"help='Live tail streams are closed after this many seconds.',default=900"`
+
+	PublishEnabled      bool `kong:"help='Enable the HTTP ingest endpoint (POST /v1/publish); requires admin credentials.',default=false"`
+	PublishMaxBatchSize int  `kong:"help='Maximum number of messages in a single publish request.',default=100"`
+	PublishMaxBodyBytes int  `kong:"help='Maximum size of a publish request body in bytes.',default=5242880"`
+	PublishTimeoutSec   int  `kong:"help='How long to wait for publisher confirms in seconds.',default=10"`
+
+	// BuildVersion is the version the binary was built with (set via ldflags)
+	BuildVersion string `kong:"-"`
+
 	KongContext *kong.Context `kong:"-"`
+
+	// args and envFile are kept so that the config can be parsed again on
+	// reload (envFile is only set for a config created via New)
+	args    []string `kong:"-"`
+	envFile string   `kong:"-"`
+
+	// envFileKeys are the env vars that were set from the .env file
+	envFileKeys map[string]struct{} `kong:"-"`
+
+	// configFileKeys maps settings (flag names) that were set from a config
+	// file to that file
+	configFileKeys map[string]string `kong:"-"`
+}
+
+// AuthConfig holds the credentials accepted by a listener
+type AuthConfig struct {
+	AdminTokens             []string          `kong:"help='Bearer token(s) that grant the admin role (admin routes are disabled if no credential grants it).'" redact:"true"`
+	OperatorTokens          []string          `kong:"help='Bearer token(s) that grant the operator role (read-only admin routes, pprof).'" redact:"true"`
+	AuthTokensFile          string            `kong:"help='File with one <role>:<token> entry per line (ie. a mounted K8S secret).'"`
+	AuthHMACAdminKeys       map[string]string `kong:"help='HMAC keys (key-id=secret;...) that grant the admin role.'" redact:"true"`
+	AuthHMACOperatorKeys    map[string]string `kong:"help='HMAC keys (key-id=secret;...) that grant the operator role.'" redact:"true"`
+	AuthHMACMaxSkewSec      int               `kong:"help='Maximum allowed clock skew for HMAC signed requests in seconds.',default=300"`
+	AuthClientCertAdmins    []string          `kong:"help='Client certificate CNs/SANs that grant the admin role (requires TLS with a client CA).'"`
+	AuthClientCertOperators []string          `kong:"help='Client certificate CNs/SANs that grant the operator role (requires TLS with a client CA).'"`
+}
+
+// Empty returns true if no credentials are configured
+func (a *AuthConfig) Empty() bool {
+	return len(a.AdminTokens) == 0 && len(a.OperatorTokens) == 0 && a.AuthTokensFile == "" &&
+		len(a.AuthHMACAdminKeys) == 0 && len(a.AuthHMACOperatorKeys) == 0 &&
+		len(a.AuthClientCertAdmins) == 0 && len(a.AuthClientCertOperators) == 0
+}
+
+// TLSConfig holds the TLS settings for a listener; TLS is disabled if no
+// certificate is configured
+type TLSConfig struct {
+	TLSCertFile     string   `kong:"help='TLS certificate file (PEM); enables TLS.'"`
+	TLSKeyFile      string   `kong:"help='TLS private key file (PEM).'"`
+	TLSClientCAFile string   `kong:"help='CA bundle (PEM) used to verify client certificates (mTLS).'"`
+	TLSClientAuth   string   `kong:"help='Whether client certificates are verified if given or required (only used with a client CA).',enum='optional,require',default='optional'"`
+	TLSMinVersion   string   `kong:"help='Minimum TLS version.',enum='1.2,1.3',default='1.2'"`
+	TLSCipherPolicy string   `kong:"help='TLS 1.2 cipher suite policy (modern = ECDHE + AEAD only).',enum='default,modern',default='default'"`
+	TLSCipherSuites []string `kong:"help='Explicit TLS 1.2 cipher suite names (overrides the cipher policy).'"`
+}
+
+// Enabled returns true if a certificate is configured
+func (t *TLSConfig) Enabled() bool {
+	return t.TLSCertFile != ""
 }
 
+// New parses flags, env vars, the .env file and config files; kong calls
+// Validate() while parsing, so New exits listing every invalid setting
 func New(version string) *Config {
-	// Attempt to load .env - do not fail if it's not there. Only environment
-	// that might have this is in local/dev; staging, prod should not have one.
-	if err := godotenv.Load(EnvFile); err != nil {
-		zap.L().Warn("unable to load dotenv file", zap.String("err", err.Error()))
+	envFileKeys := loadEnvFile(EnvFile)
+
+	cfg, parser := newParser(version)
+
+	ctx, err := parser.Parse(os.Args[1:])
+	parser.FatalIfErrorf(err)
+
+	cfg.KongContext = ctx
+	cfg.args = os.Args[1:]
+	cfg.envFile = EnvFile
+	cfg.envFileKeys = envFileKeys
+
+	parser.FatalIfErrorf(cfg.checkUnknownEnv())
+
+	return cfg
+}
+
+// Parse parses args and the environment without loading the .env file or
+// exiting on errors (ie. for tests and tooling)
+func Parse(version string, args []string) (*Config, error) {
+	cfg, parser := newParser(version)
+
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse config")
+	}
+
+	cfg.KongContext = ctx
+	cfg.args = args
+
+	if err := cfg.checkUnknownEnv(); err != nil {
+		return nil, err
 	}
 
-	cfg := &Config{}
-	cfg.KongContext = kong.Parse(
+	return cfg, nil
+}
+
+func newParser(version string) (*Config, *kong.Kong) {
+	cfg := &Config{
+		BuildVersion:   version,
+		envFileKeys:    make(map[string]struct{}),
+		configFileKeys: make(map[string]string),
+	}
+
+	parser := kong.Must(
 		cfg,
 		kong.Name("go-svc-template"),
 		kong.Description("Golang service"),
@@ -65,13 +247,31 @@ func New(version string) *Config {
 		},
 	)
 
-	return cfg
+	return cfg, parser
 }
 
-func (c *Config) Validate() error {
-	if c == nil {
-		return errors.New("Config cannot be nil")
+// loadEnvFile loads the .env file (if any) and returns the keys that were set
+// from it; variables that are already set in the environment take precedence.
+func loadEnvFile(file string) map[string]struct{} {
+	keys := make(map[string]struct{})
+
+	// Attempt to load .env - do not fail if it's not there. Only environment
+	// that might have this is in local/dev; staging, prod should not have one.
+	vars, err := godotenv.Read(file)
+	if err != nil {
+		zap.L().Warn("unable to load dotenv file", zap.String("err", err.Error()))
+		return keys
+	}
+
+	for k := range vars {
+		if _, ok := os.LookupEnv(k); !ok {
+			keys[k] = struct{}{}
+		}
+	}
+
+	if err := godotenv.Load(file); err != nil {
+		zap.L().Warn("unable to load dotenv file", zap.String("err", err.Error()))
 	}
 
-	return nil
+	return keys
 }
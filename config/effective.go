@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+)
+
+// Source describes where a config value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+
+	// SourceFile is used for values loaded from a config file (see --config)
+	// or the .env file
+	SourceFile Source = "file"
+
+	// Redacted replaces secret values in the effective config
+	Redacted = "REDACTED"
+
+	// RedactTag marks fields that must not be shown in the effective config.
+	// Use `redact:"true"` to hide the whole value (map keys are kept),
+	// `redact:"url"` to only hide the password of URL(s) and
+	// `redact:"endpoint"` to only keep the scheme and host of URL(s).
+	RedactTag = "redact"
+)
+
+type EffectiveValue struct {
+	Name     string      `json:"name"`
+	Env      string      `json:"env,omitempty"`
+	File     string      `json:"file,omitempty"`
+	Value    interface{} `json:"value"`
+	Source   Source      `json:"source"`
+	Redacted bool        `json:"redacted,omitempty"`
+}
+
+// Effective is the resolved config along with the source of every value
+type Effective struct {
+	Values []*EffectiveValue `json:"values"`
+
+	// IgnoredEnv lists GO_SVC_TEMPLATE_* variables that do not match any
+	// setting (see UnknownEnv)
+	IgnoredEnv []string `json:"ignored_env"`
+}
+
+// Effective returns the resolved config with secrets redacted; only works for
+// a config created via New()
+func (c *Config) Effective() (*Effective, error) {
+	if c.KongContext == nil {
+		return nil, errors.New("config was not parsed")
+	}
+
+	setFlags := make(map[*kong.Flag]struct{})
+
+	for _, p := range c.KongContext.Path {
+		// Resolved flags come from config files (see BeforeResolve)
+		if p.Flag != nil && !p.Resolved {
+			setFlags[p.Flag] = struct{}{}
+		}
+	}
+
+	tags := fieldTags(reflect.ValueOf(c).Elem(), RedactTag)
+	effective := &Effective{
+		Values:     make([]*EffectiveValue, 0),
+		IgnoredEnv: make([]string, 0),
+	}
+
+	for _, group := range c.KongContext.Model.AllFlags(true) {
+		for _, flag := range group {
+			// Skips help, version and other CLI-only flags
+			if len(flag.Envs) == 0 {
+				continue
+			}
+
+			v := &EffectiveValue{
+				Name:   flag.Name,
+				Env:    flag.Envs[0],
+				Source: SourceDefault,
+			}
+
+			for _, env := range flag.Envs {
+				if _, ok := os.LookupEnv(env); ok && v.Source == SourceDefault {
+					v.Env = env
+					v.Source = SourceEnv
+
+					if _, ok := c.envFileKeys[env]; ok {
+						v.Source = SourceFile
+						v.File = EnvFile
+					}
+				}
+			}
+
+			if file, ok := c.configFileKeys[flag.Name]; ok {
+				v.Source = SourceFile
+				v.File = file
+			}
+
+			if _, ok := setFlags[flag]; ok {
+				v.Source = SourceFlag
+			}
+
+			v.Value, v.Redacted = redact(flag.Target, tags[fieldKey(flag.Target)])
+
+			effective.Values = append(effective.Values, v)
+		}
+	}
+
+	for _, u := range c.UnknownEnv() {
+		effective.IgnoredEnv = append(effective.IgnoredEnv, u.Name)
+	}
+
+	return effective, nil
+}
+
+// Dump writes the effective config as indented JSON
+func (c *Config) Dump(w io.Writer) error {
+	effective, err := c.Effective()
+	if err != nil {
+		return errors.Wrap(err, "unable to determine effective config")
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(effective); err != nil {
+		return errors.Wrap(err, "unable to encode effective config")
+	}
+
+	return nil
+}
+
+// fieldTags maps the address of every (nested) config field to the value of
+// the given struct tag (fields without the tag are omitted)
+func fieldTags(v reflect.Value, name string) map[uintptr]string {
+	tags := make(map[uintptr]string)
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			for k, tag := range fieldTags(v.Field(i), name) {
+				tags[k] = tag
+			}
+
+			continue
+		}
+
+		if tag := field.Tag.Get(name); tag != "" {
+			tags[fieldKey(v.Field(i))] = tag
+		}
+	}
+
+	return tags
+}
+
+func fieldKey(v reflect.Value) uintptr {
+	if !v.CanAddr() {
+		return 0
+	}
+
+	return v.Addr().Pointer()
+}
+
+// redact returns a copy of v that is safe to show, and whether anything was
+// redacted
+func redact(v reflect.Value, tag string) (interface{}, bool) {
+	if tag == "" || v.IsZero() {
+		return v.Interface(), false
+	}
+
+	hide := func(s string) string {
+		switch tag {
+		case "url":
+			return RedactURL(s)
+		case "endpoint":
+			return RedactEndpoint(s)
+		}
+
+		return Redacted
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return hide(v.String()), true
+	case reflect.Slice:
+		out := make([]string, v.Len())
+
+		for i := range out {
+			out[i] = hide(v.Index(i).String())
+		}
+
+		return out, true
+	case reflect.Map:
+		out := make(map[string]string, v.Len())
+
+		for _, k := range v.MapKeys() {
+			out[k.String()] = hide(v.MapIndex(k).String())
+		}
+
+		return out, true
+	}
+
+	return Redacted, true
+}
+
+// RedactURL hides the password in a URL; unparseable values are hidden
+// entirely since they might still contain credentials
+func RedactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Redacted
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+
+	return u.String()
+}
+
+// RedactEndpoint keeps only the scheme and host of a URL; for URLs that carry
+// credentials in their path or query (ie. webhook tokens)
+func RedactEndpoint(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return Redacted
+	}
+
+	endpoint := &url.URL{Scheme: u.Scheme, Host: u.Host}
+
+	if u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		endpoint.Path = "/" + Redacted
+	}
+
+	return endpoint.String()
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	UnknownEnvIgnore = "ignore"
+	UnknownEnvWarn   = "warn"
+	UnknownEnvFail   = "fail"
+)
+
+// serviceLinkEnv matches the env vars Kubernetes injects for the
+// go-svc-template Service (ie. GO_SVC_TEMPLATE_SERVICE_HOST or
+// GO_SVC_TEMPLATE_PORT_80_TCP_ADDR); they share our prefix but are not settings
+var serviceLinkEnv = regexp.MustCompile(
+	`^` + EnvConfigPrefix + `_(SERVICE_HOST|SERVICE_PORT(_[A-Z0-9_]+)?|PORT(_[0-9]+_(TCP|UDP|SCTP)(_(PROTO|PORT|ADDR))?)?)$`,
+)
+
+// UnknownEnv is a GO_SVC_TEMPLATE_* env var that does not match any setting
+type UnknownEnv struct {
+	Name string `json:"name"`
+
+	// Suggestion is the closest known env var, if any is close enough to
+	// likely be what was meant
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (u *UnknownEnv) String() string {
+	if u.Suggestion == "" {
+		return u.Name
+	}
+
+	return fmt.Sprintf("%s (did you mean %s?)", u.Name, u.Suggestion)
+}
+
+// UnknownEnv returns every GO_SVC_TEMPLATE_* env var (including the ones set
+// from the .env file) that does not match a setting, skipping Kubernetes
+// service link vars; empty for a config that was not parsed
+func (c *Config) UnknownEnv() []*UnknownEnv {
+	unknown := make([]*UnknownEnv, 0)
+
+	if c.KongContext == nil {
+		return unknown
+	}
+
+	known := make([]string, 0)
+	knownSet := make(map[string]struct{})
+
+	for _, group := range c.KongContext.Model.AllFlags(true) {
+		for _, flag := range group {
+			for _, env := range flag.Envs {
+				known = append(known, env)
+				knownSet[env] = struct{}{}
+			}
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+
+		if !strings.HasPrefix(name, EnvConfigPrefix+"_") {
+			continue
+		}
+
+		if _, ok := knownSet[name]; ok {
+			continue
+		}
+
+		if serviceLinkEnv.MatchString(name) {
+			continue
+		}
+
+		unknown = append(unknown, &UnknownEnv{
+			Name:       name,
+			Suggestion: closestEnv(name, known),
+		})
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		return unknown[i].Name < unknown[j].Name
+	})
+
+	return unknown
+}
+
+// checkUnknownEnv returns an error listing unknown env vars if
+// UnknownEnvAction is "fail"; warnings are logged by deps once logging is set up
+func (c *Config) checkUnknownEnv() error {
+	if c.UnknownEnvAction != UnknownEnvFail {
+		return nil
+	}
+
+	unknown := c.UnknownEnv()
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(unknown))
+
+	for i, u := range unknown {
+		names[i] = u.String()
+	}
+
+	return fmt.Errorf("unknown env var(s) (set %s=warn to only log them): %s",
+		envName("unknown-env-action"), strings.Join(names, ", "))
+}
+
+// closestEnv returns the known env var closest to name, or "" if none is close
+// enough; the allowed distance grows with the length of the setting name
+func closestEnv(name string, known []string) string {
+	setting := strings.TrimPrefix(name, EnvConfigPrefix+"_")
+
+	maxDistance := len(setting) / 4
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	best := ""
+	bestDistance := maxDistance + 1
+
+	for _, k := range known {
+		d := levenshtein(setting, strings.TrimPrefix(k, EnvConfigPrefix+"_"))
+
+		if d < bestDistance || (d == bestDistance && k < best) {
+			best = k
+			bestDistance = d
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFlag is the name of the flag that lists the config files
+const ConfigFlag = "config"
+
+// BeforeResolve is a kong hook that registers a resolver for every file in
+// --config (in order, so later files override earlier ones). Kong applies env
+// vars before resolvers, so the resolvers skip settings whose env var is set;
+// the resulting precedence is flags > env > files > defaults.
+func (c *Config) BeforeResolve(ctx *kong.Context) error {
+	flags := make(map[string]*kong.Flag)
+
+	var configFlag *kong.Flag
+
+	for _, group := range ctx.Model.AllFlags(true) {
+		for _, flag := range group {
+			if flag.Name == ConfigFlag {
+				configFlag = flag
+				continue
+			}
+
+			// Skips help, version and other CLI-only flags
+			if len(flag.Envs) > 0 {
+				flags[flag.Name] = flag
+			}
+		}
+	}
+
+	if configFlag == nil {
+		return nil
+	}
+
+	files, _ := ctx.FlagValue(configFlag).([]string)
+
+	for _, file := range files {
+		file := file
+
+		r, err := loadConfigFile(file, flags)
+		if err != nil {
+			return err
+		}
+
+		r.onResolve = func(name string) {
+			c.configFileKeys[name] = file
+		}
+
+		ctx.AddResolver(r)
+	}
+
+	return nil
+}
+
+// fileResolver resolves flags from a (flattened) config file
+type fileResolver struct {
+	values    map[string]interface{}
+	onResolve func(name string)
+}
+
+// Validate satisfies the kong.Resolver interface; unknown keys are rejected
+// when the file is loaded
+func (f *fileResolver) Validate(_ *kong.Application) error {
+	return nil
+}
+
+// Resolve satisfies the kong.Resolver interface
+func (f *fileResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (interface{}, error) {
+	v, ok := f.values[flag.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	// Env vars take precedence over files
+	for _, env := range flag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil
+		}
+	}
+
+	if f.onResolve != nil {
+		f.onResolve(flag.Name)
+	}
+
+	return normalize(v, flag.Target.Type()), nil
+}
+
+// normalize converts scalars to strings for string settings (and string
+// slices/maps) since YAML happily decodes "tls-min-version: 1.2" as a float
+func normalize(v interface{}, t reflect.Type) interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		if isScalar(v) {
+			return fmt.Sprint(v)
+		}
+	case reflect.Slice:
+		if items, ok := v.([]interface{}); ok && t.Elem().Kind() == reflect.String {
+			out := make([]interface{}, len(items))
+
+			for i, item := range items {
+				out[i] = normalize(item, t.Elem())
+			}
+
+			return out
+		}
+	case reflect.Map:
+		if items, ok := v.(map[string]interface{}); ok && t.Elem().Kind() == reflect.String {
+			out := make(map[string]interface{}, len(items))
+
+			for k, item := range items {
+				out[k] = normalize(item, t.Elem())
+			}
+
+			return out
+		}
+	}
+
+	return v
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case bool, int, int64, uint64, float64:
+		return true
+	}
+
+	return false
+}
+
+// loadConfigFile reads a YAML (.yaml, .yml) or JSON (.json) config file.
+// Keys are flag names (snake_case works too) and may be nested, ie.
+// "rate-limit: {enabled: true}" sets rate-limit-enabled.
+func loadConfigFile(file string, flags map[string]*kong.Flag) (*fileResolver, error) {
+	f, err := os.Open(kong.ExpandPath(file))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open config file")
+	}
+	defer f.Close()
+
+	var values map[string]interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".yaml", ".yml":
+		values, err = decodeYAML(f)
+	case ".json":
+		values, err = decodeJSON(f)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type '%s' (use .yaml, .yml or .json)", file, ext)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: unable to decode config file", file)
+	}
+
+	r := &fileResolver{
+		values: make(map[string]interface{}),
+	}
+
+	unknown := make([]string, 0)
+
+	flatten(values, "", flags, r.values, &unknown)
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+
+		return nil, fmt.Errorf("%s: unknown setting(s): %s", file, strings.Join(unknown, ", "))
+	}
+
+	return r, nil
+}
+
+func decodeYAML(r io.Reader) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	if err := yaml.NewDecoder(r).Decode(&values); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func decodeJSON(r io.Reader) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// flatten maps (nested) keys to flag names; a nested object is only descended
+// into if its key is not a flag itself (map settings take objects as values)
+func flatten(values map[string]interface{}, prefix string, flags map[string]*kong.Flag, out map[string]interface{}, unknown *[]string) {
+	for k, v := range values {
+		name := prefix + strings.ReplaceAll(k, "_", "-")
+
+		if _, ok := flags[name]; ok {
+			out[name] = v
+			continue
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(nested, name+"-", flags, out, unknown)
+			continue
+		}
+
+		*unknown = append(*unknown, name)
+	}
+}
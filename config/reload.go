@@ -0,0 +1,453 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/fsnotify/fsnotify"
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+)
+
+const (
+	// ReloadTag marks settings that can be changed without a restart, ie.
+	// `reload:"true"`; changes to any other setting are rejected on reload
+	ReloadTag = "reload"
+
+	// reloadDebounce coalesces the burst of events editors (and K8S
+	// ConfigMap updates) produce for a single change
+	reloadDebounce = time.Second
+)
+
+// Change is a setting whose value differs between two configs
+type Change struct {
+	// Setting is the flag name, ie. rabbit-num-consumers
+	Setting string
+	Old     interface{}
+	New     interface{}
+
+	redact string
+}
+
+// String describes the change with secrets redacted
+func (c *Change) String() string {
+	from, _ := redact(reflect.ValueOf(c.Old), c.redact)
+	to, _ := redact(reflect.ValueOf(c.New), c.redact)
+
+	return fmt.Sprintf("%s: %v -> %v", c.Setting, from, to)
+}
+
+// Changes are sorted by setting
+type Changes []*Change
+
+// Has returns true if any of the settings changed
+func (c Changes) Has(settings ...string) bool {
+	for _, change := range c {
+		for _, s := range settings {
+			if change.Setting == s {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c Changes) settings() []string {
+	settings := make([]string, len(c))
+
+	for i, change := range c {
+		settings[i] = change.Setting
+	}
+
+	return settings
+}
+
+// ReloadFunc is called with the previous and the new config after a reload
+// changed at least one (reloadable) setting
+type ReloadFunc func(old, updated *Config, changes Changes)
+
+// ReloadResult describes the outcome of a reload
+type ReloadResult struct {
+	// Applied are the changes to reloadable settings
+	Applied Changes
+
+	// Rejected are the changes to settings that require a restart; the new
+	// config keeps their previous values
+	Rejected Changes
+}
+
+type subscriber struct {
+	name string
+	fn   ReloadFunc
+}
+
+// Reloader re-reads flags, env vars, the .env file and config files and
+// hands reloadable changes to subscribers. Configs are never modified once
+// created: every reload produces a new *Config (see Current()), so anything
+// that needs to pick up changes must subscribe.
+type Reloader struct {
+	current     atomic.Pointer[Config]
+	subscribers []*subscriber
+	log         clog.ICustomLog
+	mtx         *sync.Mutex
+}
+
+func NewReloader(cfg *Config, log clog.ICustomLog) (*Reloader, error) {
+	if cfg == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+
+	if cfg.KongContext == nil {
+		return nil, errors.New("config was not parsed")
+	}
+
+	if log == nil {
+		return nil, errors.New("log cannot be nil")
+	}
+
+	r := &Reloader{
+		subscribers: make([]*subscriber, 0),
+		log:         log.With(zap.String("pkg", "config")),
+		mtx:         &sync.Mutex{},
+	}
+
+	r.current.Store(cfg)
+
+	return r, nil
+}
+
+// Current returns the config as of the last reload
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// Subscribe registers fn to be called (in registration order) after every
+// reload that applied changes; name is used in logs
+func (r *Reloader) Subscribe(name string, fn ReloadFunc) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.subscribers = append(r.subscribers, &subscriber{name: name, fn: fn})
+}
+
+// Reload parses the config again. An invalid config is rejected as a whole
+// (the current one stays in effect); otherwise changes to settings that are
+// not reloadable are reverted and logged, and the remaining changes are
+// applied and handed to subscribers.
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	logger := r.log.With(zap.String("method", "Reload"))
+
+	old := r.Current()
+
+	envFileKeys := old.envFileKeys
+	restoreEnv := func() {}
+
+	if old.envFile != "" {
+		var err error
+
+		envFileKeys, restoreEnv, err = reloadEnvFile(old.envFile, old.envFileKeys)
+		if err != nil {
+			logger.Error("unable to read env file, keeping the current config", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	cfg, err := Parse(old.BuildVersion, old.args)
+	if err != nil {
+		// The current config stays in effect, so must the env it came from
+		restoreEnv()
+
+		logger.Error("ignoring invalid config, keeping the current one", zap.Error(err))
+		return nil, err
+	}
+
+	cfg.envFile = old.envFile
+	cfg.envFileKeys = envFileKeys
+
+	result := diff(old, cfg)
+
+	for _, c := range result.Rejected {
+		logger.Error("setting cannot be changed without a restart, keeping the current value",
+			zap.String("setting", c.Setting), zap.String("change", c.String()))
+	}
+
+	if len(result.Applied) == 0 {
+		logger.Info("config reloaded, no changes to apply")
+		return result, nil
+	}
+
+	r.current.Store(cfg)
+
+	for _, c := range result.Applied {
+		logger.Info("applying config change", zap.String("setting", c.Setting), zap.String("change", c.String()))
+	}
+
+	for _, s := range r.subscribers {
+		r.notify(s, old, cfg, result.Applied)
+	}
+
+	logger.Info("config reloaded", zap.Strings("applied", result.Applied.settings()))
+
+	return result, nil
+}
+
+// notify shields the reloader from subscribers that panic
+func (r *Reloader) notify(s *subscriber, old, updated *Config, changes Changes) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.log.Error("config reload subscriber panicked",
+				zap.String("subscriber", s.name), zap.Any("panic", v))
+		}
+	}()
+
+	s.fn(old, updated, changes)
+}
+
+// Watch reloads the config on SIGHUP and whenever a config file (or the .env
+// file) changes, until ctx is done
+func (r *Reloader) Watch(ctx context.Context) error {
+	files := make([]string, 0)
+
+	cfg := r.Current()
+
+	for _, f := range cfg.ConfigFiles {
+		files = append(files, kong.ExpandPath(f))
+	}
+
+	if cfg.envFile != "" {
+		files = append(files, cfg.envFile)
+	}
+
+	var watcher *fsnotify.Watcher
+
+	if len(files) > 0 {
+		var err error
+
+		watcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			return errors.Wrap(err, "unable to create file watcher")
+		}
+
+		// Watch directories rather than files: editors and K8S replace files
+		// (rename/symlink swap) which drops a watch on the file itself
+		dirs := make(map[string]struct{})
+
+		for _, f := range files {
+			dirs[filepath.Dir(f)] = struct{}{}
+		}
+
+		for dir := range dirs {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return errors.Wrapf(err, "unable to watch '%s'", dir)
+			}
+		}
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go r.watch(ctx, watcher, files, sighup)
+
+	return nil
+}
+
+func (r *Reloader) watch(ctx context.Context, watcher *fsnotify.Watcher, files []string, sighup chan os.Signal) {
+	logger := r.log.With(zap.String("method", "watch"))
+
+	defer signal.Stop(sighup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+
+	if watcher != nil {
+		defer watcher.Close()
+
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	names := make(map[string]struct{})
+
+	for _, f := range files {
+		names[filepath.Base(f)] = struct{}{}
+	}
+
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-sighup:
+			logger.Info("received SIGHUP, reloading config")
+
+			// Errors are logged by Reload()
+			_, _ = r.Reload()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+
+			// K8S swaps the "..data" symlink when a ConfigMap changes
+			if _, ok := names[filepath.Base(event.Name)]; !ok && !strings.HasPrefix(filepath.Base(event.Name), "..") {
+				continue
+			}
+
+			timer.Reset(reloadDebounce)
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+
+			logger.Error("config file watcher error", zap.Error(err))
+		case <-timer.C:
+			logger.Info("config file changed, reloading config")
+
+			_, _ = r.Reload()
+		}
+	}
+}
+
+// diff compares every setting of old and updated; changes to settings
+// without the reload tag are reverted in updated
+func diff(old, updated *Config) *ReloadResult {
+	result := &ReloadResult{
+		Applied:  make(Changes, 0),
+		Rejected: make(Changes, 0),
+	}
+
+	oldFlags := make(map[string]reflect.Value)
+
+	for _, group := range old.KongContext.Model.AllFlags(true) {
+		for _, flag := range group {
+			oldFlags[flag.Name] = flag.Target
+		}
+	}
+
+	reloadable := fieldTags(reflect.ValueOf(updated).Elem(), ReloadTag)
+	redactable := fieldTags(reflect.ValueOf(updated).Elem(), RedactTag)
+
+	for _, group := range updated.KongContext.Model.AllFlags(true) {
+		for _, flag := range group {
+			// Skips help, version and other CLI-only flags
+			if len(flag.Envs) == 0 {
+				continue
+			}
+
+			oldValue, ok := oldFlags[flag.Name]
+			if !ok || reflect.DeepEqual(oldValue.Interface(), flag.Target.Interface()) {
+				continue
+			}
+
+			c := &Change{
+				Setting: flag.Name,
+				Old:     oldValue.Interface(),
+				New:     flag.Target.Interface(),
+				redact:  redactable[fieldKey(flag.Target)],
+			}
+
+			if reloadable[fieldKey(flag.Target)] == "true" {
+				result.Applied = append(result.Applied, c)
+				continue
+			}
+
+			flag.Target.Set(oldValue)
+			result.Rejected = append(result.Rejected, c)
+		}
+	}
+
+	sort.Slice(result.Applied, func(i, j int) bool { return result.Applied[i].Setting < result.Applied[j].Setting })
+	sort.Slice(result.Rejected, func(i, j int) bool { return result.Rejected[i].Setting < result.Rejected[j].Setting })
+
+	return result
+}
+
+// reloadEnvFile re-applies the .env file: variables that came from the file
+// are updated (or unset if they were removed from it); variables set in the
+// environment still take precedence. The returned func reverts the env to how
+// it was before the call. A missing file is treated as empty (staging, prod
+// run without one); if the file cannot be read, nothing is changed.
+func reloadEnvFile(file string, prev map[string]struct{}) (map[string]struct{}, func(), error) {
+	vars, err := godotenv.Read(file)
+	if os.IsNotExist(err) {
+		vars, err = map[string]string{}, nil
+	}
+
+	if err != nil {
+		return prev, nil, errors.Wrapf(err, "unable to read env file '%s'", file)
+	}
+
+	keys := make(map[string]struct{})
+	saved := make(map[string]*string)
+
+	save := func(k string) {
+		if _, ok := saved[k]; ok {
+			return
+		}
+
+		if v, ok := os.LookupEnv(k); ok {
+			saved[k] = &v
+		} else {
+			saved[k] = nil
+		}
+	}
+
+	for k, v := range vars {
+		_, fromFile := prev[k]
+
+		if _, ok := os.LookupEnv(k); ok && !fromFile {
+			continue
+		}
+
+		save(k)
+		os.Setenv(k, v)
+		keys[k] = struct{}{}
+	}
+
+	for k := range prev {
+		if _, ok := vars[k]; !ok {
+			save(k)
+			os.Unsetenv(k)
+		}
+	}
+
+	restore := func() {
+		for k, v := range saved {
+			if v == nil {
+				os.Unsetenv(k)
+				continue
+			}
+
+			os.Setenv(k, *v)
+		}
+	}
+
+	return keys, restore, nil
+}
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/streamdal/go-svc-template/ratelimit"
+)
+
+// FieldError describes an invalid setting (or an invalid combination of
+// settings)
+type FieldError struct {
+	// Settings are flag names, ie. rabbit-url
+	Settings []string
+	Message  string
+
+	envs []string
+}
+
+func (f *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", strings.Join(f.envs, ", "), f.Message)
+}
+
+// ValidationError lists every problem found by Validate()
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (v *ValidationError) Error() string {
+	lines := make([]string, 0, len(v.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%d invalid setting(s):", len(v.Errors)))
+
+	for _, e := range v.Errors {
+		lines = append(lines, "  "+e.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks every setting and returns a *ValidationError listing all
+// problems at once. Per-field checks (ranges, formats) are done first, then
+// checks that span multiple settings.
+func (c *Config) Validate() error {
+	if c == nil {
+		return errors.New("Config cannot be nil")
+	}
+
+	v := &validator{
+		envs: c.envNames(),
+	}
+
+	c.validateFields(v)
+	c.validateCrossFields(v)
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+
+	return nil
+}
+
+func (c *Config) validateFields(v *validator) {
+	v.listenAddress("api-listen-address", c.APIListenAddress, true)
+	v.listenAddress("admin-listen-address", c.AdminListenAddress, false)
+	v.listenAddress("grpc-listen-address", c.GRPCListenAddress, false)
+
+	v.oneOf("log-level", c.LogLevel, "debug", "info", "warn", "error")
+	v.min("health-freq-sec", c.HealthFreqSec, 1)
+	v.min("log-level-default-ttl-sec", c.LogLevelDefaultTTLSec, 1)
+	v.min("log-level-max-ttl-sec", c.LogLevelMaxTTLSec, 1)
+
+	v.min("http-read-timeout-sec", c.HTTPReadTimeoutSec, 0)
+	v.min("http-read-header-timeout-sec", c.HTTPReadHeaderTimeoutSec, 1)
+	v.min("http-write-timeout-sec", c.HTTPWriteTimeoutSec, 0)
+	v.min("http-idle-timeout-sec", c.HTTPIdleTimeoutSec, 0)
+	v.min("http-max-header-bytes", c.HTTPMaxHeaderBytes, 1)
+	v.min("http-max-body-bytes", int(c.HTTPMaxBodyBytes), 0)
+	v.min("http-max-conns", c.HTTPMaxConns, 0)
+
+	for route, limit := range c.HTTPRouteMaxBodyBytes {
+		if limit < 0 {
+			v.fail(fmt.Sprintf("limit for '%s' cannot be negative", route), "http-route-max-body-bytes")
+		}
+	}
+
+	v.rateRule("rate-limit-default", c.RateLimitDefault)
+	v.min("rate-limit-forwarded-for-hops", c.RateLimitForwardedForHops, 1)
+
+	for route, rule := range c.RateLimitRoutes {
+		if _, err := ratelimit.ParseRule(rule); err != nil {
+			v.fail(fmt.Sprintf("route '%s': %s", route, err), "rate-limit-routes")
+		}
+	}
+
+	v.min("cors-max-age-sec", c.CORSMaxAgeSec, 0)
+
+	v.min("health-rabbit-interval-sec", c.HealthRabbitIntervalSec, 0)
+	v.min("health-cache-interval-sec", c.HealthCacheIntervalSec, 0)
+	v.min("health-consumer-interval-sec", c.HealthConsumerIntervalSec, 0)
+	v.min("health-consumer-stall-sec", c.HealthConsumerStallSec, 1)
+	v.min("health-tls-interval-sec", c.HealthTLSIntervalSec, 0)
+	v.min("health-tls-expiry-warn-sec", c.HealthTLSExpiryWarnSec, 0)
+	v.urls("health-webhook-urls", c.HealthWebhookURLs, "http", "https")
+	v.min("health-webhook-debounce-sec", c.HealthWebhookDebounceSec, 0)
+	v.min("health-webhook-timeout-sec", c.HealthWebhookTimeoutSec, 1)
+
+	if c.OtelSampleRatio < 0 || c.OtelSampleRatio > 1 {
+		v.fail("must be between 0 and 1", "otel-sample-ratio")
+	}
+
+	v.min("otel-metric-interval", c.OtelMetricInterval, 1)
+
+	if len(c.RabbitURL) == 0 {
+		v.fail("at least one URL is required", "rabbit-url")
+	}
+
+	v.urls("rabbit-url", c.RabbitURL, "amqp", "amqps")
+	v.required("rabbit-exchange-name", c.RabbitExchangeName)
+	v.min("rabbit-num-consumers", c.RabbitNumConsumers, 1)
+	v.min("rabbit-retry-reconnect-sec", c.RabbitRetryReconnectSec, 1)
+
+	v.min("tail-max-subscribers", c.TailMaxSubscribers, 1)
+	v.min("tail-buffer-size", c.TailBufferSize, 1)
+	v.min("tail-max-body-bytes", c.TailMaxBodyBytes, 0)
+	v.min("tail-max-duration-sec", c.TailMaxDurationSec, 1)
+
+	v.min("publish-max-batch-size", c.PublishMaxBatchSize, 1)
+	v.min("publish-max-body-bytes", c.PublishMaxBodyBytes, 1)
+	v.min("publish-timeout-sec", c.PublishTimeoutSec, 1)
+
+	v.min("auth-hmac-max-skew-sec", c.Auth.AuthHMACMaxSkewSec, 1)
+	v.min("admin-listener-auth-hmac-max-skew-sec", c.AdminListenerAuth.AuthHMACMaxSkewSec, 1)
+}
+
+func (c *Config) validateCrossFields(v *validator) {
+	if c.LogLevelDefaultTTLSec > c.LogLevelMaxTTLSec {
+		v.fail("default TTL cannot exceed the max TTL", "log-level-default-ttl-sec", "log-level-max-ttl-sec")
+	}
+
+	if c.AdminListenAddress != "" && c.AdminListenAddress == c.APIListenAddress {
+		v.fail("admin listener cannot use the API listen address (leave it empty to serve admin routes on the API listener)",
+			"admin-listen-address", "api-listen-address")
+	}
+
+	if c.GRPCListenAddress != "" && (c.GRPCListenAddress == c.APIListenAddress || c.GRPCListenAddress == c.AdminListenAddress) {
+		v.fail("gRPC listener needs its own listen address", "grpc-listen-address")
+	}
+
+	v.tls("api-", &c.APITLS)
+	v.tls("admin-listener-", &c.AdminListenerTLS)
+	v.tls("grpc-", &c.GRPCTLS)
+
+	if c.RabbitUseTLS {
+		for _, u := range c.RabbitURL {
+			if strings.HasPrefix(u, "amqp://") {
+				v.fail(fmt.Sprintf("'%s' must use the amqps:// scheme when TLS is enabled", RedactURL(u)), "rabbit-use-tls", "rabbit-url")
+			}
+		}
+	}
+
+	if c.RabbitSkipVerifyTLS && !c.RabbitUseTLS {
+		v.fail("has no effect unless TLS is enabled", "rabbit-skip-verify-tls", "rabbit-use-tls")
+	}
+
+	if c.RabbitQueueExclusive && c.RabbitNumConsumers > 1 {
+		v.fail("an exclusive queue only allows a single consumer", "rabbit-queue-exclusive", "rabbit-num-consumers")
+	}
+
+	if c.RateLimitEnabled && c.RateLimitKey == "header" && c.RateLimitHeader == "" {
+		v.fail("a header is required when limiting by header", "rate-limit-header", "rate-limit-key")
+	}
+
+	if c.CORSAllowCredentials {
+		for _, o := range c.CORSAllowedOrigins {
+			if o == "*" {
+				v.fail("credentials cannot be allowed for any origin (*); list the allowed origins instead",
+					"cors-allow-credentials", "cors-allowed-origins")
+			}
+		}
+	}
+
+	if c.TelemetryProvider == "otel" && c.OtelExporter == "file" && c.OtelFilePath == "" {
+		v.fail("a file path is required for the file exporter", "otel-file-path", "otel-exporter")
+	}
+}
+
+// validator collects errors; settings are referred to by flag name and
+// reported by env var name
+type validator struct {
+	envs   map[string]string
+	errors []*FieldError
+}
+
+func (v *validator) fail(msg string, settings ...string) {
+	envs := make([]string, len(settings))
+
+	for i, s := range settings {
+		envs[i] = v.env(s)
+	}
+
+	v.errors = append(v.errors, &FieldError{
+		Settings: settings,
+		Message:  msg,
+		envs:     envs,
+	})
+}
+
+func (v *validator) env(setting string) string {
+	if env, ok := v.envs[setting]; ok {
+		return env
+	}
+
+	return envName(setting)
+}
+
+func (v *validator) required(setting, value string) {
+	if value == "" {
+		v.fail("cannot be empty", setting)
+	}
+}
+
+func (v *validator) min(setting string, value, min int) {
+	if value < min {
+		v.fail(fmt.Sprintf("must be >= %d (got %d)", min, value), setting)
+	}
+}
+
+// oneOf allows value to be empty (ie. "use the default")
+func (v *validator) oneOf(setting, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	v.fail(fmt.Sprintf("'%s' must be one of %s", value, strings.Join(allowed, ", ")), setting)
+}
+
+// listenAddress checks for host:port (the host is optional)
+func (v *validator) listenAddress(setting, value string, required bool) {
+	if value == "" {
+		if required {
+			v.fail("cannot be empty", setting)
+		}
+
+		return
+	}
+
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		v.fail(fmt.Sprintf("'%s' must be in the format [host]:port", value), setting)
+		return
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		v.fail(fmt.Sprintf("'%s' has an invalid port", value), setting)
+	}
+}
+
+func (v *validator) urls(setting string, values []string, schemes ...string) {
+	for _, value := range values {
+		u, err := url.Parse(value)
+		if err != nil {
+			v.fail(fmt.Sprintf("'%s' is not a valid URL", RedactEndpoint(value)), setting)
+			continue
+		}
+
+		valid := false
+
+		for _, s := range schemes {
+			if u.Scheme == s {
+				valid = true
+			}
+		}
+
+		if !valid {
+			v.fail(fmt.Sprintf("'%s' must use one of the schemes %s", RedactEndpoint(value), strings.Join(schemes, ", ")), setting)
+			continue
+		}
+
+		if u.Host == "" {
+			v.fail(fmt.Sprintf("'%s' has no host", RedactEndpoint(value)), setting)
+		}
+	}
+}
+
+func (v *validator) rateRule(setting, value string) {
+	if _, err := ratelimit.ParseRule(value); err != nil {
+		v.fail(err.Error(), setting)
+	}
+}
+
+func (v *validator) tls(prefix string, t *TLSConfig) {
+	if t.TLSCertFile != "" && t.TLSKeyFile == "" {
+		v.fail("a key file is required with a certificate", prefix+"tls-key-file", prefix+"tls-cert-file")
+	}
+
+	if t.TLSKeyFile != "" && t.TLSCertFile == "" {
+		v.fail("a certificate is required with a key file", prefix+"tls-cert-file", prefix+"tls-key-file")
+	}
+
+	if t.TLSClientCAFile != "" && t.TLSCertFile == "" {
+		v.fail("client certificates can only be verified if TLS is enabled", prefix+"tls-client-ca-file", prefix+"tls-cert-file")
+	}
+
+	if t.TLSClientAuth == "require" && t.TLSClientCAFile == "" {
+		v.fail("requiring client certificates needs a client CA", prefix+"tls-client-auth", prefix+"tls-client-ca-file")
+	}
+}
+
+// envNames maps flag names to their (first) env var; empty for a config that
+// was not parsed
+func (c *Config) envNames() map[string]string {
+	envs := make(map[string]string)
+
+	if c.KongContext == nil {
+		return envs
+	}
+
+	for _, group := range c.KongContext.Model.AllFlags(true) {
+		for _, flag := range group {
+			if len(flag.Envs) > 0 {
+				envs[flag.Name] = flag.Envs[0]
+			}
+		}
+	}
+
+	return envs
+}
+
+// envName derives the env var for a flag name the way kong.DefaultEnvars does
+func envName(setting string) string {
+	return EnvConfigPrefix + "_" + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
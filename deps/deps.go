@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/InVisionApp/go-health"
@@ -17,30 +18,54 @@ import (
 	"go.uber.org/zap/zapcore"
 
 	"github.com/streamdal/go-svc-template/backends/cache"
+	"github.com/streamdal/go-svc-template/backends/publisher"
+	"github.com/streamdal/go-svc-template/buildinfo"
 	"github.com/streamdal/go-svc-template/clog"
 	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/metrics"
 	"github.com/streamdal/go-svc-template/services/proc"
+	"github.com/streamdal/go-svc-template/telemetry"
+	"github.com/streamdal/go-svc-template/tlscert"
 )
 
 const (
 	DefaultHealthCheckIntervalSecs = 1
 )
 
-type customCheck struct{}
-
 type Dependencies struct {
 	// Backends
 	RabbitBackend rabbit.IRabbit
 	CacheBackend  cache.ICache
 
+	// PublisherBackend is only set if config.PublishEnabled is true
+	PublisherBackend publisher.IPublisher
+
 	// Services
 	ProcessorService proc.IProc
 
 	Health         health.IHealth
+	HealthTimings  *HealthTimings
 	DefaultContext context.Context
 
 	NewRelicApp *newrelic.Application
-	Config      *config.Config
+
+	// Config is the config the service was started with; it is never
+	// modified. Settings that can be reloaded must be read via Reloader.
+	Config *config.Config
+
+	// Reloader reloads the config on SIGHUP or config file changes and
+	// notifies subscribers about changes to reloadable settings
+	Reloader *config.Reloader
+
+	// Telemetry is the tracing + metrics provider (New Relic, OTel or noop)
+	Telemetry telemetry.ITelemetry
+
+	// Metrics are the Prometheus collectors served via /metrics
+	Metrics *metrics.Metrics
+
+	// TLSCerts are the (auto-reloading) certificates by listener name; only
+	// listeners with TLS enabled have an entry
+	TLSCerts map[string]*tlscert.Reloader
 
 	// Log is the main, shared logger (you should use this for all logging)
 	Log clog.ICustomLog
@@ -48,8 +73,16 @@ type Dependencies struct {
 	// ZapLog is the zap logger (you shouldn't need this outside of deps)
 	ZapLog *zap.Logger
 
+	// LogLevels controls the log level at runtime (per pkg)
+	LogLevels *clog.LevelController
+
 	// ZapCore can be used to generate a brand-new logger (you shouldn't need this very often)
 	ZapCore zapcore.Core
+
+	// Health checks with reloadable thresholds
+	rabbitCheck   *rabbitCheck
+	consumerCheck *consumerCheck
+	tlsCheck      *tlsCheck
 }
 
 func New(cfg *config.Config) (*Dependencies, error) {
@@ -67,12 +100,17 @@ func New(cfg *config.Config) (*Dependencies, error) {
 		return nil, errors.Wrap(err, "unable to setup logging")
 	}
 
-	if err := d.setupHealth(); err != nil {
-		return nil, errors.Wrap(err, "unable to setup health")
+	if err := d.setupTelemetry(); err != nil {
+		return nil, errors.Wrap(err, "unable to setup telemetry")
 	}
 
-	if err := d.Health.Start(); err != nil {
-		return nil, errors.Wrap(err, "unable to start health runner")
+	d.Metrics = metrics.New(cfg.ServiceName)
+
+	bi := buildinfo.Get(cfg.ServiceName, cfg.EnvName, cfg.BuildVersion)
+	d.Metrics.BuildInfo.WithLabelValues(bi.Version, bi.Revision, strconv.FormatBool(bi.Dirty), bi.GoVersion, bi.Service, bi.Env).Set(1)
+
+	if err := d.setupTLS(); err != nil {
+		return nil, errors.Wrap(err, "unable to setup TLS")
 	}
 
 	if err := d.setupBackends(cfg); err != nil {
@@ -83,10 +121,87 @@ func New(cfg *config.Config) (*Dependencies, error) {
 		return nil, errors.Wrap(err, "unable to setup services")
 	}
 
+	// Health setup must occur after backends + services have been set up as
+	// the built-in checks depend on them
+	if err := d.setupHealth(); err != nil {
+		return nil, errors.Wrap(err, "unable to setup health")
+	}
+
+	if err := d.Health.Start(); err != nil {
+		return nil, errors.Wrap(err, "unable to start health runner")
+	}
+
+	if err := d.setupReloader(); err != nil {
+		return nil, errors.Wrap(err, "unable to setup config reloader")
+	}
+
 	return d, nil
 }
 
+// Shutdown flushes buffered telemetry (ie. spans waiting in the OTel batch
+// queue or New Relic's final harvest); call it before exiting
+func (d *Dependencies) Shutdown(ctx context.Context) error {
+	if d.Telemetry == nil {
+		return nil
+	}
+
+	if err := d.Telemetry.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "unable to shutdown telemetry")
+	}
+
+	return nil
+}
+
+// setupReloader should be called last; API (and other) subscribers are added
+// once they exist
+func (d *Dependencies) setupReloader() error {
+	reloader, err := config.NewReloader(d.Config, d.Log)
+	if err != nil {
+		return errors.Wrap(err, "unable to create config reloader")
+	}
+
+	d.Reloader = reloader
+
+	d.Reloader.Subscribe("deps", d.reloadConfig)
+	d.Reloader.Subscribe("proc", d.reloadProc)
+
+	if err := d.Reloader.Watch(d.DefaultContext); err != nil {
+		return errors.Wrap(err, "unable to watch config")
+	}
+
+	return nil
+}
+
+// reloadConfig applies changes to the log level and health check thresholds
+func (d *Dependencies) reloadConfig(_, updated *config.Config, changes config.Changes) {
+	if changes.Has("log-level") {
+		d.LogLevels.SetDefault(logLevel(updated))
+	}
+
+	d.rabbitCheck.inspectQueue.Store(updated.HealthRabbitInspectQueue)
+	d.consumerCheck.stall.Store(int64(time.Duration(updated.HealthConsumerStallSec) * time.Second))
+
+	if d.tlsCheck != nil {
+		d.tlsCheck.expiryWarn.Store(int64(time.Duration(updated.HealthTLSExpiryWarnSec) * time.Second))
+	}
+}
+
+// reloadProc scales the consumers of the "main" RabbitMap entry
+func (d *Dependencies) reloadProc(_, updated *config.Config, changes config.Changes) {
+	if !changes.Has("rabbit-num-consumers") {
+		return
+	}
+
+	if err := d.ProcessorService.SetNumConsumers("main", updated.RabbitNumConsumers); err != nil {
+		d.Log.Error("unable to change number of consumers", zap.Error(err))
+	}
+}
+
 func (d *Dependencies) setupNewRelic() error {
+	if d.Config.TelemetryProvider != telemetry.ProviderNewRelic {
+		return nil
+	}
+
 	if d.Config.NewRelicAppName == "" || d.Config.NewRelicLicenseKey == "" {
 		return nil
 	}
@@ -114,18 +229,21 @@ func (d *Dependencies) setupNewRelic() error {
 func (d *Dependencies) setupLogging() error {
 	var core zapcore.Core
 
+	// The core lets through the most verbose level in use; clog filters per pkg
+	d.LogLevels = clog.NewLevelController(logLevel(d.Config))
+
 	if d.Config.LogConfig == "dev" {
 		zc := zap.NewDevelopmentConfig()
 		zc.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 
 		core = zapcore.NewCore(zapcore.NewConsoleEncoder(zc.EncoderConfig),
 			zapcore.AddSync(os.Stdout),
-			zap.DebugLevel,
+			d.LogLevels,
 		)
 	} else {
 		core = zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
 			zapcore.AddSync(os.Stdout),
-			zap.InfoLevel,
+			d.LogLevels,
 		)
 	}
 
@@ -144,10 +262,81 @@ func (d *Dependencies) setupLogging() error {
 	d.ZapCore = core
 
 	// Create a new primary logger that will be passed to everyone
-	d.Log = clog.New(d.ZapLog, zap.String("env", d.Config.EnvName))
+	d.Log = clog.NewWithLevels(d.ZapLog, d.LogLevels, zap.String("env", d.Config.EnvName))
 
 	d.Log.Debug("Logging initialized")
 
+	// config.New only fails on unknown env vars if asked to; warn about them
+	// now that we can log
+	if d.Config.UnknownEnvAction == config.UnknownEnvWarn {
+		for _, u := range d.Config.UnknownEnv() {
+			d.Log.Warn("ignoring env var that does not match any setting",
+				zap.String("env", u.Name), zap.String("suggestion", u.Suggestion))
+		}
+	}
+
+	return nil
+}
+
+// logLevel returns the configured default level; debug for the dev logging
+// config and info otherwise if not set
+func logLevel(cfg *config.Config) zapcore.Level {
+	if cfg.LogLevel != "" {
+		if level, err := zapcore.ParseLevel(cfg.LogLevel); err == nil {
+			return level
+		}
+	}
+
+	if cfg.LogConfig == "dev" {
+		return zap.DebugLevel
+	}
+
+	return zap.InfoLevel
+}
+
+// setupTelemetry should be called _after_ setupNewRelic() and setupLogging()
+func (d *Dependencies) setupTelemetry() error {
+	logger := d.Log.With(zap.String("method", "setupTelemetry"))
+
+	switch d.Config.TelemetryProvider {
+	case telemetry.ProviderNewRelic:
+		if d.NewRelicApp == nil {
+			logger.Debug("New Relic is not configured, telemetry disabled")
+			d.Telemetry = &telemetry.Noop{}
+
+			return nil
+		}
+
+		nr, err := telemetry.NewNewRelic(d.NewRelicApp)
+		if err != nil {
+			return errors.Wrap(err, "unable to create newrelic telemetry")
+		}
+
+		d.Telemetry = nr
+	case telemetry.ProviderOTel:
+		ot, err := telemetry.NewOTel(&telemetry.OTelOptions{
+			ServiceName:    d.Config.ServiceName,
+			ServiceVersion: d.Config.BuildVersion,
+			EnvName:        d.Config.EnvName,
+			Exporter:       d.Config.OtelExporter,
+			Endpoint:       d.Config.OtelEndpoint,
+			Insecure:       d.Config.OtelInsecure,
+			Headers:        d.Config.OtelHeaders,
+			FilePath:       d.Config.OtelFilePath,
+			SampleRatio:    d.Config.OtelSampleRatio,
+			MetricInterval: time.Duration(d.Config.OtelMetricInterval) * time.Second,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to create otel telemetry")
+		}
+
+		d.Telemetry = ot
+	default:
+		d.Telemetry = &telemetry.Noop{}
+	}
+
+	logger.Debug("Telemetry initialized", zap.String("provider", d.Config.TelemetryProvider))
+
 	return nil
 }
 
@@ -158,18 +347,65 @@ func (d *Dependencies) setupHealth() error {
 	gohealth := health.New()
 	gohealth.DisableLogging()
 
-	cc := &customCheck{}
+	listener, err := newHealthListener(&HealthListenerOptions{
+		Service:  d.Config.ServiceName,
+		Env:      d.Config.EnvName,
+		URLs:     d.Config.HealthWebhookURLs,
+		Secret:   d.Config.HealthWebhookSecret,
+		Debounce: time.Duration(d.Config.HealthWebhookDebounceSec) * time.Second,
+		Timeout:  time.Duration(d.Config.HealthWebhookTimeoutSec) * time.Second,
+		Metrics:  d.Metrics,
+		Log:      d.Log,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create health listener")
+	}
 
-	err := gohealth.AddChecks([]*health.Config{
+	gohealth.StatusListener = listener
+
+	d.Health = gohealth
+	d.HealthTimings = newHealthTimings()
+
+	d.rabbitCheck = &rabbitCheck{rabbit: d.RabbitBackend}
+	d.rabbitCheck.inspectQueue.Store(d.Config.HealthRabbitInspectQueue)
+
+	d.consumerCheck = &consumerCheck{proc: d.ProcessorService}
+	d.consumerCheck.stall.Store(int64(time.Duration(d.Config.HealthConsumerStallSec) * time.Second))
+
+	checks := []*health.Config{
 		{
-			Name:     "health-check",
-			Checker:  cc,
-			Interval: time.Duration(DefaultHealthCheckIntervalSecs) * time.Second,
-			Fatal:    true,
+			Name:     "rabbit",
+			Checker:  d.rabbitCheck,
+			Interval: d.healthInterval(d.Config.HealthRabbitIntervalSec),
+			Fatal:    d.Config.HealthRabbitFatal,
 		},
-	})
+		{
+			Name:     "cache",
+			Checker:  &cacheCheck{cache: d.CacheBackend},
+			Interval: d.healthInterval(d.Config.HealthCacheIntervalSec),
+			Fatal:    d.Config.HealthCacheFatal,
+		},
+		{
+			Name:     "consumers",
+			Checker:  d.consumerCheck,
+			Interval: d.healthInterval(d.Config.HealthConsumerIntervalSec),
+			Fatal:    d.Config.HealthConsumerFatal,
+		},
+	}
 
-	d.Health = gohealth
+	if len(d.TLSCerts) > 0 {
+		d.tlsCheck = &tlsCheck{certs: d.TLSCerts}
+		d.tlsCheck.expiryWarn.Store(int64(time.Duration(d.Config.HealthTLSExpiryWarnSec) * time.Second))
+
+		checks = append(checks, &health.Config{
+			Name:     "tls",
+			Checker:  d.tlsCheck,
+			Interval: d.healthInterval(d.Config.HealthTLSIntervalSec),
+			Fatal:    d.Config.HealthTLSFatal,
+		})
+	}
+
+	err = d.addHealthChecks(checks)
 
 	if err != nil {
 		return err
@@ -178,6 +414,20 @@ func (d *Dependencies) setupHealth() error {
 	return nil
 }
 
+// addHealthChecks wraps every checker so that check durations are recorded in
+// d.HealthTimings before handing them off to go-health
+func (d *Dependencies) addHealthChecks(cfgs []*health.Config) error {
+	for _, cfg := range cfgs {
+		cfg.Checker = &timedCheck{
+			name:    cfg.Name,
+			checker: cfg.Checker,
+			timings: d.HealthTimings,
+		}
+	}
+
+	return d.Health.AddChecks(cfgs)
+}
+
 func (d *Dependencies) setupBackends(cfg *config.Config) error {
 	llog := d.Log.With(zap.String("method", "setupBackends"))
 
@@ -215,6 +465,9 @@ func (d *Dependencies) setupBackends(cfg *config.Config) error {
 		AppID:             cfg.ServiceName,
 		UseTLS:            cfg.RabbitUseTLS,
 		SkipVerifyTLS:     cfg.RabbitSkipVerifyTLS,
+		Log: newRabbitLogger(d.Log.With(zap.String("pkg", "rabbit")), func() {
+			d.Metrics.RabbitReconnects.WithLabelValues("main").Inc()
+		}),
 	})
 	if err != nil {
 		return errors.Wrap(err, "unable to create new dedicated rabbit backend")
@@ -222,6 +475,53 @@ func (d *Dependencies) setupBackends(cfg *config.Config) error {
 
 	d.RabbitBackend = rabbitBackend
 
+	if cfg.PublishEnabled {
+		llog.Debug("Setting up publisher backend")
+
+		if err := d.setupPublisher(cfg); err != nil {
+			return errors.Wrap(err, "unable to setup publisher backend")
+		}
+	}
+
+	return nil
+}
+
+// setupPublisher creates a dedicated, producer-mode rabbit backend (so that
+// publishing never contends with consumers) and a confirm-mode publisher on top
+func (d *Dependencies) setupPublisher(cfg *config.Config) error {
+	producerBackend, err := rabbit.New(&rabbit.Options{
+		URLs: cfg.RabbitURL,
+		Mode: rabbit.Producer,
+		Bindings: []rabbit.Binding{
+			{
+				ExchangeName:    cfg.RabbitExchangeName,
+				ExchangeType:    amqp.ExchangeTopic,
+				ExchangeDeclare: cfg.RabbitExchangeDeclare,
+			},
+		},
+		RetryReconnectSec: rabbit.DefaultRetryReconnectSec,
+		AppID:             cfg.ServiceName,
+		UseTLS:            cfg.RabbitUseTLS,
+		SkipVerifyTLS:     cfg.RabbitSkipVerifyTLS,
+		Log: newRabbitLogger(d.Log.With(zap.String("pkg", "rabbit")), func() {
+			d.Metrics.RabbitReconnects.WithLabelValues("publisher").Inc()
+		}),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create producer rabbit backend")
+	}
+
+	pub, err := publisher.New(&publisher.Options{
+		Rabbit:       producerBackend,
+		ExchangeName: cfg.RabbitExchangeName,
+		AppID:        cfg.ServiceName,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create publisher")
+	}
+
+	d.PublisherBackend = pub
+
 	return nil
 }
 
@@ -238,8 +538,9 @@ func (d *Dependencies) setupServices(cfg *config.Config) error {
 				Func:           "MainConsumeFunc",
 			},
 		},
-		NewRelic: d.NewRelicApp,
-		Log:      d.Log,
+		Telemetry: d.Telemetry,
+		Metrics:   d.Metrics,
+		Log:       d.Log,
 	}, cfg)
 	if err != nil {
 		return errors.Wrap(err, "unable to setup proc service")
@@ -264,14 +565,3 @@ func createTLSConfig(caCert, clientCert, clientKey string) (*tls.Config, error)
 		RootCAs:      caCertPool,
 	}, nil
 }
-
-// Status satisfies the go-health.ICheckable interface
-func (c *customCheck) Status() (interface{}, error) {
-	if false {
-		return nil, errors.New("something major just broke")
-	}
-
-	// You can return additional information pertaining to the check as long
-	// as it can be JSON marshalled
-	return map[string]int{}, nil
-}
@@ -0,0 +1,13 @@
+package deps
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDepsSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Deps Suite")
+}
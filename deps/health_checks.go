@@ -0,0 +1,187 @@
+package deps
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/streamdal/rabbit"
+
+	"github.com/streamdal/go-svc-template/backends/cache"
+	"github.com/streamdal/go-svc-template/backends/rabbitinfo"
+	"github.com/streamdal/go-svc-template/services/proc"
+	"github.com/streamdal/go-svc-template/tlscert"
+)
+
+const (
+	cacheCheckKey = "__health-check__"
+)
+
+// rabbitCheck verifies that the rabbit backend has an open connection and
+// channel; optionally also reports queue depth (via passive declare).
+type rabbitCheck struct {
+	rabbit       rabbit.IRabbit
+	inspectQueue atomic.Bool
+}
+
+// cacheCheck performs a set/get/remove round-trip on the cache backend
+type cacheCheck struct {
+	cache cache.ICache
+}
+
+// consumerCheck is a watchdog that fails if a consumer group has a non-empty
+// queue but has not made progress for longer than 'stall'
+type consumerCheck struct {
+	proc  proc.IProc
+	stall atomic.Int64 // time.Duration
+}
+
+// tlsCheck reports the expiry of every listener's certificate; it fails once
+// a certificate has expired
+type tlsCheck struct {
+	certs      map[string]*tlscert.Reloader
+	expiryWarn atomic.Int64 // time.Duration
+}
+
+// healthInterval returns the interval for a check, falling back to
+// HealthFreqSec (and then DefaultHealthCheckIntervalSecs) if not set
+func (d *Dependencies) healthInterval(sec int) time.Duration {
+	if sec <= 0 {
+		sec = d.Config.HealthFreqSec
+	}
+
+	if sec <= 0 {
+		sec = DefaultHealthCheckIntervalSecs
+	}
+
+	return time.Duration(sec) * time.Second
+}
+
+// Status satisfies the go-health.ICheckable interface
+func (c *rabbitCheck) Status() (interface{}, error) {
+	state := rabbitinfo.GetState(c.rabbit)
+
+	details := map[string]interface{}{
+		"connected":    state.Connected,
+		"channel_open": state.ChannelOpen,
+		"reconnecting": state.Reconnecting,
+	}
+
+	if state.Reconnecting {
+		return details, rabbitinfo.ErrReconnecting
+	}
+
+	if !state.Connected {
+		return details, errors.New("rabbit connection is closed")
+	}
+
+	if !state.ChannelOpen {
+		return details, errors.New("rabbit channel is closed")
+	}
+
+	if c.inspectQueue.Load() {
+		q, err := rabbitinfo.InspectQueue(c.rabbit)
+		if err != nil {
+			return details, errors.Wrap(err, "unable to inspect queue")
+		}
+
+		details["queue"] = q
+	}
+
+	return details, nil
+}
+
+// Status satisfies the go-health.ICheckable interface
+func (c *cacheCheck) Status() (interface{}, error) {
+	value := time.Now().UnixNano()
+
+	c.cache.Set(cacheCheckKey, value)
+	defer c.cache.Remove(cacheCheckKey)
+
+	got, ok := c.cache.Get(cacheCheckKey)
+	if !ok {
+		return nil, errors.New("cache round-trip failed: key not found after set")
+	}
+
+	if got != value {
+		return nil, fmt.Errorf("cache round-trip failed: expected '%v', got '%v'", value, got)
+	}
+
+	return nil, nil
+}
+
+// Status satisfies the go-health.ICheckable interface
+func (c *consumerCheck) Status() (interface{}, error) {
+	if !c.proc.Started() {
+		return map[string]string{"status": "consumers not started"}, nil
+	}
+
+	details := make(map[string]interface{})
+	stalled := make([]string, 0)
+	stall := time.Duration(c.stall.Load())
+
+	for name, s := range c.proc.Status() {
+		idle := time.Since(s.LastProgressAt)
+
+		groupDetails := map[string]interface{}{
+			"running":          s.Running,
+			"last_progress_at": s.LastProgressAt,
+		}
+
+		details[name] = groupDetails
+
+		if idle < stall {
+			continue
+		}
+
+		q, err := c.proc.InspectQueue(name)
+		if err != nil {
+			// Broker connectivity is the rabbit check's concern
+			groupDetails["error"] = err.Error()
+			continue
+		}
+
+		groupDetails["messages"] = q.Messages
+
+		if q.Messages > 0 {
+			stalled = append(stalled, fmt.Sprintf("%s (%d messages, idle for %s)", name, q.Messages, idle.Round(time.Second)))
+		}
+	}
+
+	if len(stalled) > 0 {
+		return details, fmt.Errorf("consumer group(s) not making progress: %s", strings.Join(stalled, ", "))
+	}
+
+	return details, nil
+}
+
+// Status satisfies the go-health.ICheckable interface
+func (c *tlsCheck) Status() (interface{}, error) {
+	details := make(map[string]interface{})
+	expired := make([]string, 0)
+	expiryWarn := time.Duration(c.expiryWarn.Load())
+
+	for name, r := range c.certs {
+		notAfter := r.NotAfter()
+		remaining := time.Until(notAfter)
+
+		details[name] = map[string]interface{}{
+			"not_after":      notAfter,
+			"expires_in_sec": int64(remaining.Seconds()),
+			"expiring_soon":  remaining < expiryWarn,
+			"last_reload":    r.LastReload(),
+		}
+
+		if remaining <= 0 {
+			expired = append(expired, name)
+		}
+	}
+
+	if len(expired) > 0 {
+		return details, fmt.Errorf("TLS certificate expired for listener(s): %s", strings.Join(expired, ", "))
+	}
+
+	return details, nil
+}
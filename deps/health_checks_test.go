@@ -0,0 +1,285 @@
+package deps
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/streamdal/rabbit"
+
+	"github.com/streamdal/go-svc-template/backends/cache"
+	"github.com/streamdal/go-svc-template/backends/rabbitinfo"
+	"github.com/streamdal/go-svc-template/services/proc"
+)
+
+var _ = Describe("health checks", func() {
+	Describe("rabbitCheck", func() {
+		It("should check the connection and optionally the queue", func() {
+			reconnecting := &rabbit.Rabbit{ConsumerRWMutex: &sync.RWMutex{}}
+			reconnecting.ConsumerRWMutex.Lock()
+			defer reconnecting.ConsumerRWMutex.Unlock()
+
+			tests := []struct {
+				name         string
+				rabbit       rabbit.IRabbit
+				inspectQueue bool
+				expected     string
+			}{
+				{"connected", &fakeRabbit{}, false, ""},
+				{"queue not inspectable", &fakeRabbit{}, true, "unable to inspect queue"},
+				{"not connected", &rabbit.Rabbit{ConsumerRWMutex: &sync.RWMutex{}}, false, "rabbit connection is closed"},
+				{"reconnecting", reconnecting, true, rabbitinfo.ErrReconnecting.Error()},
+			}
+
+			for _, t := range tests {
+				c := &rabbitCheck{rabbit: t.rabbit}
+				c.inspectQueue.Store(t.inspectQueue)
+
+				details, err := c.Status()
+				Expect(details).To(HaveKey("connected"), t.name)
+
+				if t.expected == "" {
+					Expect(err).ToNot(HaveOccurred(), t.name)
+					continue
+				}
+
+				Expect(err).To(MatchError(ContainSubstring(t.expected)), t.name)
+			}
+		})
+	})
+
+	Describe("cacheCheck", func() {
+		It("should perform a round-trip", func() {
+			working, err := cache.New()
+			Expect(err).ToNot(HaveOccurred())
+
+			tests := []struct {
+				name     string
+				cache    cache.ICache
+				expected string
+			}{
+				{"working", working, ""},
+				{"lost write", &fakeCache{items: map[string]interface{}{}, dropWrites: true}, "key not found"},
+				{"wrong value", &fakeCache{items: map[string]interface{}{}, override: "stale"}, "expected"},
+			}
+
+			for _, t := range tests {
+				_, err := (&cacheCheck{cache: t.cache}).Status()
+
+				if t.expected == "" {
+					Expect(err).ToNot(HaveOccurred(), t.name)
+				} else {
+					Expect(err).To(MatchError(ContainSubstring(t.expected)), t.name)
+				}
+
+				_, ok := t.cache.Get(cacheCheckKey)
+				Expect(ok).To(BeFalse(), t.name+": check key is removed")
+			}
+		})
+	})
+
+	Describe("consumerCheck", func() {
+		const stall = time.Minute
+
+		idle := func(d time.Duration) *proc.ConsumerStatus {
+			return &proc.ConsumerStatus{Running: 2, LastProgressAt: time.Now().Add(-d)}
+		}
+
+		It("should fail groups that are idle with a non-empty queue", func() {
+			tests := []struct {
+				name      string
+				started   bool
+				status    map[string]*proc.ConsumerStatus
+				queues    map[string]*rabbitinfo.Queue
+				queueErr  error
+				expected  string
+				inspected []string
+			}{
+				{
+					name:   "not started",
+					status: map[string]*proc.ConsumerStatus{"main": idle(time.Hour)},
+					queues: map[string]*rabbitinfo.Queue{"main": {Messages: 10}},
+				},
+				{
+					name:    "making progress",
+					started: true,
+					status:  map[string]*proc.ConsumerStatus{"main": idle(time.Second)},
+					queues:  map[string]*rabbitinfo.Queue{"main": {Messages: 10}},
+				},
+				{
+					name:      "idle with an empty queue",
+					started:   true,
+					status:    map[string]*proc.ConsumerStatus{"main": idle(time.Hour)},
+					queues:    map[string]*rabbitinfo.Queue{"main": {Messages: 0}},
+					inspected: []string{"main"},
+				},
+				{
+					name:      "idle for exactly the stall duration",
+					started:   true,
+					status:    map[string]*proc.ConsumerStatus{"main": idle(stall)},
+					queues:    map[string]*rabbitinfo.Queue{"main": {Messages: 3}},
+					expected:  "main (3 messages",
+					inspected: []string{"main"},
+				},
+				{
+					name:    "one of several groups stalled",
+					started: true,
+					status: map[string]*proc.ConsumerStatus{
+						"main":  idle(time.Second),
+						"audit": idle(time.Hour),
+					},
+					queues: map[string]*rabbitinfo.Queue{
+						"main":  {Messages: 10},
+						"audit": {Messages: 5},
+					},
+					expected:  "not making progress: audit (5 messages",
+					inspected: []string{"audit"},
+				},
+				{
+					name:      "queue cannot be inspected",
+					started:   true,
+					status:    map[string]*proc.ConsumerStatus{"main": idle(time.Hour)},
+					queueErr:  rabbitinfo.ErrReconnecting,
+					inspected: []string{"main"},
+				},
+			}
+
+			for _, t := range tests {
+				fp := &fakeProc{started: t.started, status: t.status, queues: t.queues, queueErr: t.queueErr}
+
+				c := &consumerCheck{proc: fp}
+				c.stall.Store(int64(stall))
+
+				details, err := c.Status()
+
+				if t.expected == "" {
+					Expect(err).ToNot(HaveOccurred(), t.name)
+				} else {
+					Expect(err).To(MatchError(ContainSubstring(t.expected)), t.name)
+				}
+
+				Expect(fp.inspected).To(ConsistOf(t.inspected), t.name)
+
+				if t.queueErr != nil {
+					Expect(details).To(HaveKeyWithValue("main", HaveKeyWithValue("error", t.queueErr.Error())), t.name)
+				}
+			}
+		})
+	})
+})
+
+// fakeRabbit is a rabbit backend that cannot be inspected by rabbitinfo
+type fakeRabbit struct{}
+
+func (f *fakeRabbit) Consume(_ context.Context, _ chan *rabbit.ConsumeError, _ func(msg amqp.Delivery) error) {
+}
+
+func (f *fakeRabbit) ConsumeOnce(_ context.Context, _ func(msg amqp.Delivery) error) error {
+	return nil
+}
+
+func (f *fakeRabbit) Publish(_ context.Context, _ string, _ []byte) error { return nil }
+
+func (f *fakeRabbit) Stop() error { return nil }
+
+func (f *fakeRabbit) Close() error { return nil }
+
+// fakeCache drops writes or returns 'override' for every key, if set
+type fakeCache struct {
+	items      map[string]interface{}
+	dropWrites bool
+	override   interface{}
+}
+
+func (f *fakeCache) Add(key string, value interface{}) error {
+	f.Set(key, value)
+	return nil
+}
+
+func (f *fakeCache) Set(key string, value interface{}) {
+	if !f.dropWrites {
+		f.items[key] = value
+	}
+}
+
+func (f *fakeCache) SetWithTTL(key string, value interface{}, _ time.Duration) {
+	f.Set(key, value)
+}
+
+func (f *fakeCache) Get(key string) (interface{}, bool) {
+	v, ok := f.items[key]
+	if ok && f.override != nil {
+		return f.override, true
+	}
+
+	return v, ok
+}
+
+func (f *fakeCache) GetWithExpiration(key string) (interface{}, time.Time, bool) {
+	v, ok := f.Get(key)
+	return v, time.Time{}, ok
+}
+
+func (f *fakeCache) Contains(key string) bool {
+	_, ok := f.items[key]
+	return ok
+}
+
+func (f *fakeCache) Remove(key string) bool {
+	_, ok := f.items[key]
+	delete(f.items, key)
+
+	return ok
+}
+
+func (f *fakeCache) Keys(_ string) []string { return nil }
+
+func (f *fakeCache) Stats() *cache.Stats { return &cache.Stats{} }
+
+// fakeProc records which queues were inspected
+type fakeProc struct {
+	started   bool
+	status    map[string]*proc.ConsumerStatus
+	queues    map[string]*rabbitinfo.Queue
+	queueErr  error
+	inspected []string
+}
+
+func (f *fakeProc) StartConsumers() error { return nil }
+
+func (f *fakeProc) Started() bool { return f.started }
+
+func (f *fakeProc) Paused() bool { return false }
+
+func (f *fakeProc) Status() map[string]*proc.ConsumerStatus { return f.status }
+
+func (f *fakeProc) InspectQueue(name string) (*rabbitinfo.Queue, error) {
+	f.inspected = append(f.inspected, name)
+
+	if f.queueErr != nil {
+		return nil, f.queueErr
+	}
+
+	q, ok := f.queues[name]
+	if !ok {
+		return nil, errors.New("unknown consumer")
+	}
+
+	return q, nil
+}
+
+func (f *fakeProc) Inspect() map[string]*proc.Inspection { return nil }
+
+func (f *fakeProc) InspectConsumer(_ string) (*proc.Inspection, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeProc) SetNumConsumers(_ string, _ int) error { return nil }
+
+func (f *fakeProc) SubscribeTail(_ *proc.TailFilter) (*proc.TailSubscription, error) {
+	return nil, errors.New("not implemented")
+}
@@ -0,0 +1,257 @@
+package deps
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/InVisionApp/go-health"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/metrics"
+)
+
+const (
+	HealthTransitionFailed    = "failed"
+	HealthTransitionRecovered = "recovered"
+
+	// HealthWebhookSignatureHeader contains the hex encoded HMAC-SHA256 of
+	// "<timestamp>.<request body>", prefixed with "sha256=" (see
+	// SignHealthEvent)
+	HealthWebhookSignatureHeader = "X-Signature-256"
+
+	// HealthWebhookTimestampHeader contains the time the request was sent
+	// (unix seconds)
+	HealthWebhookTimestampHeader = "X-Signature-Timestamp"
+
+	// HealthWebhookMaxSkew is how far the timestamp of a webhook request may
+	// be from the receiver's clock; receivers should reject requests outside
+	// of it so that captured requests cannot be replayed later on
+	HealthWebhookMaxSkew = 5 * time.Minute
+)
+
+// HealthEvent is the JSON payload POSTed to health webhooks
+type HealthEvent struct {
+	Service            string    `json:"service"`
+	Env                string    `json:"env"`
+	Check              string    `json:"check"`
+	Transition         string    `json:"transition"`
+	Fatal              bool      `json:"fatal"`
+	Error              string    `json:"error,omitempty"`
+	ContiguousFailures int64     `json:"num_failures"`
+	FailureDurationSec float64   `json:"failure_duration_sec,omitempty"`
+	Timestamp          time.Time `json:"timestamp"`
+}
+
+type HealthListenerOptions struct {
+	Service    string
+	Env        string
+	URLs       []string
+	Secret     string
+	Debounce   time.Duration
+	Timeout    time.Duration
+	Metrics    *metrics.Metrics
+	Log        clog.ICustomLog
+	HTTPClient *http.Client
+}
+
+// healthListener implements go-health.IStatusListener. Every transition is
+// logged and counted; webhook notifications are debounced per check so that a
+// flapping check results in a single notification for its final state.
+type healthListener struct {
+	options *HealthListenerOptions
+	log     clog.ICustomLog
+
+	// pending holds the latest, not-yet-sent event per check
+	pending map[string]*HealthEvent
+	// notified holds the last transition that was sent per check
+	notified map[string]string
+	timers   map[string]*time.Timer
+	mtx      *sync.Mutex
+}
+
+func newHealthListener(opts *HealthListenerOptions) (*healthListener, error) {
+	if opts == nil {
+		return nil, errors.New("options cannot be nil")
+	}
+
+	if opts.Log == nil {
+		return nil, errors.New("Log cannot be nil")
+	}
+
+	if opts.Metrics == nil {
+		return nil, errors.New("Metrics cannot be nil")
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: opts.Timeout}
+	}
+
+	return &healthListener{
+		options:  opts,
+		log:      opts.Log.With(zap.String("pkg", "health")),
+		pending:  make(map[string]*HealthEvent),
+		notified: make(map[string]string),
+		timers:   make(map[string]*time.Timer),
+		mtx:      &sync.Mutex{},
+	}, nil
+}
+
+// HealthCheckFailed satisfies the go-health.IStatusListener interface
+func (h *healthListener) HealthCheckFailed(entry *health.State) {
+	h.handle(&HealthEvent{
+		Check:              entry.Name,
+		Transition:         HealthTransitionFailed,
+		Fatal:              entry.Fatal,
+		Error:              entry.Err,
+		ContiguousFailures: entry.ContiguousFailures,
+		Timestamp:          time.Now().UTC(),
+	})
+}
+
+// HealthCheckRecovered satisfies the go-health.IStatusListener interface
+func (h *healthListener) HealthCheckRecovered(entry *health.State, recordedFailures int64, failureDurationSeconds float64) {
+	h.handle(&HealthEvent{
+		Check:              entry.Name,
+		Transition:         HealthTransitionRecovered,
+		Fatal:              entry.Fatal,
+		ContiguousFailures: recordedFailures,
+		FailureDurationSec: failureDurationSeconds,
+		Timestamp:          time.Now().UTC(),
+	})
+}
+
+func (h *healthListener) handle(event *HealthEvent) {
+	event.Service = h.options.Service
+	event.Env = h.options.Env
+
+	h.options.Metrics.HealthTransitions.WithLabelValues(event.Check, event.Transition).Inc()
+
+	fields := []zap.Field{
+		zap.String("check", event.Check),
+		zap.String("transition", event.Transition),
+		zap.Bool("fatal", event.Fatal),
+		zap.Int64("numFailures", event.ContiguousFailures),
+	}
+
+	if event.Transition == HealthTransitionFailed {
+		h.log.Warn("health check failed", append(fields, zap.String("error", event.Error))...)
+	} else {
+		h.log.Info("health check recovered", append(fields, zap.Float64("failureDurationSec", event.FailureDurationSec))...)
+	}
+
+	if len(h.options.URLs) == 0 {
+		return
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.pending[event.Check] = event
+
+	if t, ok := h.timers[event.Check]; ok {
+		t.Reset(h.options.Debounce)
+		return
+	}
+
+	h.timers[event.Check] = time.AfterFunc(h.options.Debounce, func() {
+		h.flush(event.Check)
+	})
+}
+
+// flush sends the latest pending event for a check, unless the check ended up
+// back in the state we last notified about (ie. it flapped)
+func (h *healthListener) flush(check string) {
+	h.mtx.Lock()
+
+	event := h.pending[check]
+
+	delete(h.pending, check)
+	delete(h.timers, check)
+
+	if event == nil || h.notified[check] == event.Transition {
+		h.mtx.Unlock()
+		return
+	}
+
+	// A check starts out as healthy - no point in announcing a recovery for
+	// something we never announced as failed
+	if h.notified[check] == "" && event.Transition == HealthTransitionRecovered {
+		h.mtx.Unlock()
+		return
+	}
+
+	h.notified[check] = event.Transition
+	h.mtx.Unlock()
+
+	for _, webhookURL := range h.options.URLs {
+		if err := h.send(webhookURL, event); err != nil {
+			h.log.Error("unable to send health webhook",
+				zap.String("check", check),
+				zap.String("url", config.RedactEndpoint(webhookURL)),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+func (h *healthListener) send(webhookURL string, event *HealthEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create request")
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HealthWebhookTimestampHeader, timestamp)
+
+	if h.options.Secret != "" {
+		req.Header.Set(HealthWebhookSignatureHeader, "sha256="+SignHealthEvent(h.options.Secret, timestamp, body))
+	}
+
+	resp, err := h.options.HTTPClient.Do(req)
+	if err != nil {
+		// The URL may carry a token in its path or query
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = config.RedactEndpoint(uerr.URL)
+		}
+
+		return errors.Wrap(err, "unable to perform request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code '%d'", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SignHealthEvent returns the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>"; receivers recompute it with the value of
+// HealthWebhookTimestampHeader and compare in constant time (hmac.Equal)
+func SignHealthEvent(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package deps
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/InVisionApp/go-health"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/metrics"
+)
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+	event  *HealthEvent
+}
+
+var _ = Describe("healthListener", func() {
+	var (
+		ts       *httptest.Server
+		listener *healthListener
+		m        *metrics.Metrics
+		requests []*webhookRequest
+		mtx      sync.Mutex
+	)
+
+	received := func() []*webhookRequest {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		return append([]*webhookRequest{}, requests...)
+	}
+
+	BeforeEach(func() {
+		requests = make([]*webhookRequest, 0)
+
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+
+			event := &HealthEvent{}
+			Expect(json.Unmarshal(body, event)).To(Succeed())
+
+			mtx.Lock()
+			requests = append(requests, &webhookRequest{header: r.Header, body: body, event: event})
+			mtx.Unlock()
+		}))
+
+		m = metrics.New("test")
+
+		var err error
+
+		listener, err = newHealthListener(&HealthListenerOptions{
+			Service:  "go-svc-template",
+			Env:      "test",
+			URLs:     []string{ts.URL},
+			Secret:   "webhook-secret",
+			Debounce: 50 * time.Millisecond,
+			Timeout:  time.Second,
+			Metrics:  m,
+			Log:      &clog.CustomLogNoop{},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	failed := func(check string) {
+		listener.HealthCheckFailed(&health.State{Name: check, Err: "connection refused", Fatal: true, ContiguousFailures: 3})
+	}
+
+	recovered := func(check string) {
+		listener.HealthCheckRecovered(&health.State{Name: check, Fatal: true}, 3, 12.5)
+	}
+
+	It("should sign the timestamp and body", func() {
+		failed("rabbit")
+
+		Eventually(received).Should(HaveLen(1))
+
+		req := received()[0]
+
+		ts, err := strconv.ParseInt(req.header.Get(HealthWebhookTimestampHeader), 10, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(time.Unix(ts, 0))).To(BeNumerically("<", HealthWebhookMaxSkew))
+
+		expected := "sha256=" + SignHealthEvent("webhook-secret", req.header.Get(HealthWebhookTimestampHeader), req.body)
+		Expect(hmac.Equal([]byte(req.header.Get(HealthWebhookSignatureHeader)), []byte(expected))).To(BeTrue())
+
+		// The signature covers the timestamp, so it cannot be swapped
+		Expect(SignHealthEvent("webhook-secret", strconv.FormatInt(ts+600, 10), req.body)).
+			ToNot(Equal(SignHealthEvent("webhook-secret", strconv.FormatInt(ts, 10), req.body)))
+
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.event.Service).To(Equal("go-svc-template"))
+		Expect(req.event.Env).To(Equal("test"))
+		Expect(req.event.Check).To(Equal("rabbit"))
+		Expect(req.event.Transition).To(Equal(HealthTransitionFailed))
+		Expect(req.event.Error).To(Equal("connection refused"))
+		Expect(req.event.ContiguousFailures).To(Equal(int64(3)))
+	})
+
+	It("should not sign without a secret", func() {
+		listener.options.Secret = ""
+
+		failed("rabbit")
+
+		Eventually(received).Should(HaveLen(1))
+		Expect(received()[0].header.Get(HealthWebhookSignatureHeader)).To(BeEmpty())
+		Expect(received()[0].header.Get(HealthWebhookTimestampHeader)).ToNot(BeEmpty())
+	})
+
+	It("should only notify about the final state of a flapping check", func() {
+		failed("rabbit")
+		recovered("rabbit")
+		failed("rabbit")
+
+		Eventually(received).Should(HaveLen(1))
+		Consistently(received, 200*time.Millisecond).Should(HaveLen(1))
+		Expect(received()[0].event.Transition).To(Equal(HealthTransitionFailed))
+
+		// Flapping back to the state that was already sent is not sent again
+		recovered("rabbit")
+		failed("rabbit")
+
+		Consistently(received, 200*time.Millisecond).Should(HaveLen(1))
+
+		// Every transition is still counted
+		Expect(testutil.ToFloat64(m.HealthTransitions.WithLabelValues("rabbit", HealthTransitionFailed))).To(Equal(3.0))
+		Expect(testutil.ToFloat64(m.HealthTransitions.WithLabelValues("rabbit", HealthTransitionRecovered))).To(Equal(2.0))
+	})
+
+	It("should debounce checks independently", func() {
+		failed("rabbit")
+		failed("cache")
+
+		Eventually(received).Should(HaveLen(2))
+	})
+
+	It("should notify about a recovery after a failure", func() {
+		failed("rabbit")
+		Eventually(received).Should(HaveLen(1))
+
+		recovered("rabbit")
+		Eventually(received).Should(HaveLen(2))
+
+		event := received()[1].event
+
+		Expect(event.Transition).To(Equal(HealthTransitionRecovered))
+		Expect(event.ContiguousFailures).To(Equal(int64(3)))
+		Expect(event.FailureDurationSec).To(Equal(12.5))
+	})
+
+	It("should not log webhook tokens", func() {
+		core, logs := observer.New(zapcore.DebugLevel)
+
+		listener.log = clog.New(zap.New(core))
+		listener.options.URLs = []string{"http://127.0.0.1:1/services/secret-token"}
+
+		failed("rabbit")
+
+		sendErrors := func() []observer.LoggedEntry {
+			return logs.FilterMessage("unable to send health webhook").All()
+		}
+
+		Eventually(sendErrors).Should(HaveLen(1))
+
+		entry := sendErrors()
+		Expect(entry[0].ContextMap()["url"]).To(Equal("http://127.0.0.1:1/REDACTED"))
+		Expect(fmt.Sprint(entry[0].ContextMap())).ToNot(ContainSubstring("secret-token"))
+	})
+
+	It("should not announce a recovery that was never announced as failed", func() {
+		recovered("rabbit")
+
+		Consistently(received, 200*time.Millisecond).Should(BeEmpty())
+	})
+})
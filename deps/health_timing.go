@@ -0,0 +1,55 @@
+package deps
+
+import (
+	"sync"
+	"time"
+
+	"github.com/InVisionApp/go-health"
+)
+
+// HealthTimings records how long the most recent run of each health check
+// took. go-health does not track this itself, so every checker added via
+// addHealthChecks() is wrapped in a timedCheck.
+type HealthTimings struct {
+	durations map[string]time.Duration
+	mtx       *sync.RWMutex
+}
+
+type timedCheck struct {
+	name    string
+	checker health.ICheckable
+	timings *HealthTimings
+}
+
+func newHealthTimings() *HealthTimings {
+	return &HealthTimings{
+		durations: make(map[string]time.Duration),
+		mtx:       &sync.RWMutex{},
+	}
+}
+
+// Duration returns the duration of the last run of the named check (or 0 if
+// the check has not run yet)
+func (h *HealthTimings) Duration(name string) time.Duration {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	return h.durations[name]
+}
+
+func (h *HealthTimings) set(name string, d time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.durations[name] = d
+}
+
+// Status satisfies the go-health.ICheckable interface
+func (t *timedCheck) Status() (interface{}, error) {
+	started := time.Now()
+	defer func() {
+		t.timings.set(t.name, time.Since(started))
+	}()
+
+	return t.checker.Status()
+}
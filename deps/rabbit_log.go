@@ -0,0 +1,102 @@
+package deps
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/streamdal/go-svc-template/clog"
+)
+
+// rabbitReconnectedPrefix is the (debug) message the rabbit lib logs once it
+// has successfully re-established a connection; it's the only hook we have.
+const rabbitReconnectedPrefix = "successfully reconnected"
+
+// rabbitQuietMessages are logged by the rabbit lib for every ConsumeOnce()
+// call (proc consumes one delivery at a time) and when a consumer is stopped
+// on purpose (ie. when scaling down); they are dropped to keep logs readable.
+var rabbitQuietMessages = map[string]struct{}{
+	"waiting for a single message from rabbit ...": {},
+	"ConsumeOnce finished - exiting":               {},
+	"stopped via context":                          {},
+}
+
+// rabbitLogger adapts clog to rabbit.Logger and fires onReconnect whenever the
+// rabbit lib reports a successful reconnect. It also implements
+// rabbitinfo.ReconnectTracker.
+type rabbitLogger struct {
+	log           clog.ICustomLog
+	onReconnect   func()
+	lastReconnect atomic.Int64
+}
+
+func newRabbitLogger(log clog.ICustomLog, onReconnect func()) *rabbitLogger {
+	return &rabbitLogger{
+		log:         log,
+		onReconnect: onReconnect,
+	}
+}
+
+// LastReconnect returns when the rabbit lib last reconnected (zero if never)
+func (r *rabbitLogger) LastReconnect() time.Time {
+	ts := r.lastReconnect.Load()
+	if ts == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ts)
+}
+
+func (r *rabbitLogger) Debug(args ...interface{}) {
+	if r.quiet(args) {
+		return
+	}
+
+	r.log.Debug(fmt.Sprint(args...))
+}
+
+func (r *rabbitLogger) Debugf(format string, args ...interface{}) {
+	if strings.HasPrefix(format, rabbitReconnectedPrefix) {
+		r.lastReconnect.Store(time.Now().UnixNano())
+
+		if r.onReconnect != nil {
+			r.onReconnect()
+		}
+	}
+
+	r.log.Debug(fmt.Sprintf(format, args...))
+}
+
+func (r *rabbitLogger) Info(args ...interface{}) {
+	r.log.Info(fmt.Sprint(args...))
+}
+
+func (r *rabbitLogger) Infof(format string, args ...interface{}) {
+	r.log.Info(fmt.Sprintf(format, args...))
+}
+
+func (r *rabbitLogger) Warn(args ...interface{}) {
+	if r.quiet(args) {
+		return
+	}
+
+	r.log.Warn(fmt.Sprint(args...))
+}
+
+func (r *rabbitLogger) Warnf(format string, args ...interface{}) {
+	r.log.Warn(fmt.Sprintf(format, args...))
+}
+
+func (r *rabbitLogger) Error(args ...interface{}) {
+	r.log.Error(fmt.Sprint(args...))
+}
+
+func (r *rabbitLogger) Errorf(format string, args ...interface{}) {
+	r.log.Error(fmt.Sprintf(format, args...))
+}
+
+func (r *rabbitLogger) quiet(args []interface{}) bool {
+	_, ok := rabbitQuietMessages[fmt.Sprint(args...)]
+	return ok
+}
@@ -0,0 +1,71 @@
+package deps
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/tlscert"
+)
+
+const (
+	ListenerAPI   = "api"
+	ListenerAdmin = "admin"
+	ListenerGRPC  = "grpc"
+)
+
+// setupTLS loads the certificate for every listener that has TLS enabled and
+// starts watching the files so that rotated certificates are picked up
+// without a restart
+func (d *Dependencies) setupTLS() error {
+	d.TLSCerts = make(map[string]*tlscert.Reloader)
+
+	listeners := map[string]*config.TLSConfig{
+		ListenerAPI: &d.Config.APITLS,
+	}
+
+	if d.Config.AdminListenAddress != "" {
+		listeners[ListenerAdmin] = &d.Config.AdminListenerTLS
+	}
+
+	if d.Config.GRPCListenAddress != "" {
+		listeners[ListenerGRPC] = &d.Config.GRPCTLS
+	}
+
+	for name, cfg := range listeners {
+		if !cfg.Enabled() {
+			continue
+		}
+
+		d.Log.Debug("Setting up TLS", zap.String("listener", name))
+
+		gauge := d.Metrics.TLSCertExpiry.WithLabelValues(name)
+
+		r, err := tlscert.New(&tlscert.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+			ClientAuth:   cfg.TLSClientAuth,
+			MinVersion:   cfg.TLSMinVersion,
+			CipherPolicy: cfg.TLSCipherPolicy,
+			CipherSuites: cfg.TLSCipherSuites,
+			OnReload: func(notAfter time.Time) {
+				gauge.Set(float64(notAfter.Unix()))
+			},
+			Log: d.Log.With(zap.String("listener", name)),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to setup TLS for '%s' listener", name)
+		}
+
+		if err := r.Watch(d.DefaultContext); err != nil {
+			return errors.Wrapf(err, "unable to watch certificate for '%s' listener", name)
+		}
+
+		d.TLSCerts[name] = r
+	}
+
+	return nil
+}
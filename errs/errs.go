@@ -0,0 +1,132 @@
+// Package errs is the shared error model: errors carry a machine readable
+// code (which maps to an HTTP status), a client-safe message and optional
+// field-level validation errors. The API renders them as RFC 7807 problem
+// details; anything that is not an *Error is treated as an internal error.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type Code string
+
+const (
+	CodeInvalidArgument  Code = "invalid_argument"
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodePermissionDenied Code = "permission_denied"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeRateLimited      Code = "rate_limited"
+	CodeUpstream         Code = "upstream_error"
+	CodeUnavailable      Code = "unavailable"
+	CodeTimeout          Code = "timeout"
+	CodeInternal         Code = "internal"
+)
+
+var httpStatuses = map[Code]int{
+	CodeInvalidArgument:  http.StatusBadRequest,
+	CodeUnauthenticated:  http.StatusUnauthorized,
+	CodePermissionDenied: http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeConflict:         http.StatusConflict,
+	CodePayloadTooLarge:  http.StatusRequestEntityTooLarge,
+	CodeRateLimited:      http.StatusTooManyRequests,
+	CodeUpstream:         http.StatusBadGateway,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeTimeout:          http.StatusGatewayTimeout,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+// FieldError describes why a single input field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Code Code
+
+	// Message is safe to show to clients
+	Message string
+
+	Fields []*FieldError
+
+	// Err is the underlying cause; it is logged but never shown to clients
+	Err error
+}
+
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an *Error with the given code and message that wraps err
+func Wrap(err error, code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg, Err: err}
+}
+
+// Invalid returns an invalid_argument error for a single field
+func Invalid(field, msg string) *Error {
+	return New(CodeInvalidArgument, "request is invalid").WithField(field, msg)
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %s", e.Code, e.Message, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithField adds a field-level validation error
+func (e *Error) WithField(field, msg string) *Error {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Message: msg})
+	return e
+}
+
+// HTTPStatus returns the HTTP status code for the error's code
+func (e *Error) HTTPStatus() int {
+	return HTTPStatus(e.Code)
+}
+
+// HTTPStatus maps a code to an HTTP status; unknown codes map to 500
+func HTTPStatus(code Code) int {
+	if status, ok := httpStatuses[code]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// From returns err as an *Error; errors that are not an *Error (anywhere in
+// the chain) are wrapped as internal errors.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return Wrap(err, CodeInternal, "internal server error")
+}
+
+// CodeOf returns the code of err (CodeInternal if it is not an *Error)
+func CodeOf(err error) Code {
+	return From(err).Code
+}
@@ -0,0 +1,13 @@
+package errs
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestErrsSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Errs Suite")
+}
@@ -0,0 +1,51 @@
+package errs
+
+import (
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Errs", func() {
+	Describe("HTTPStatus", func() {
+		It("should map codes to HTTP statuses", func() {
+			Expect(HTTPStatus(CodeInvalidArgument)).To(Equal(http.StatusBadRequest))
+			Expect(HTTPStatus(CodeRateLimited)).To(Equal(http.StatusTooManyRequests))
+			Expect(HTTPStatus(Code("made_up"))).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Describe("From", func() {
+		It("should find an *Error anywhere in the chain", func() {
+			err := errors.Wrap(New(CodeNotFound, "missing"), "while doing things")
+
+			Expect(From(err).Code).To(Equal(CodeNotFound))
+			Expect(CodeOf(err)).To(Equal(CodeNotFound))
+		})
+
+		It("should treat other errors as internal errors", func() {
+			cause := fmt.Errorf("boom")
+			e := From(cause)
+
+			Expect(e.Code).To(Equal(CodeInternal))
+			Expect(e.Message).ToNot(ContainSubstring("boom"))
+			Expect(errors.Is(e, cause)).To(BeTrue())
+		})
+
+		It("should return nil for nil errors", func() {
+			Expect(From(nil)).To(BeNil())
+		})
+	})
+
+	Describe("WithField", func() {
+		It("should collect field errors", func() {
+			e := Invalid("name", "required").WithField("age", "must be positive")
+
+			Expect(e.Fields).To(HaveLen(2))
+			Expect(e.HTTPStatus()).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
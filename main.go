@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/streamdal/go-svc-template/api"
 	"github.com/streamdal/go-svc-template/config"
@@ -12,10 +17,18 @@ var (
 	version = "v0.0.0"
 )
 
+// shutdownTimeout bounds how long flushing telemetry may take on exit
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	cfg := config.New(version)
-	if err := cfg.Validate(); err != nil {
-		log.Fatalf("unable to validate config: %s", err)
+
+	if cfg.DumpConfig {
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatalf("unable to dump config: %s", err)
+		}
+
+		os.Exit(0)
 	}
 
 	d, err := deps.New(cfg)
@@ -34,7 +47,37 @@ func main() {
 		log.Fatalf("unable to create API instance: %s", err)
 	}
 
-	if err := a.Run(); err != nil {
-		log.Fatalf("Run() failed: %s", err)
+	// Register your own gRPC services here (served if GRPC_LISTEN_ADDRESS is set):
+	//
+	// a.RegisterGRPC(func(s grpc.ServiceRegistrar) {
+	// 	pb.RegisterFooServer(s, foo.New(d))
+	// })
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- a.Run()
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	var runErr error
+
+	select {
+	case sig := <-sigCh:
+		log.Printf("Received %s, shutting down", sig)
+	case runErr = <-errCh:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		log.Printf("Unable to shutdown dependencies: %s", err)
+	}
+
+	if runErr != nil {
+		log.Fatalf("Run() failed: %s", runErr)
 	}
 }
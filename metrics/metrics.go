@@ -0,0 +1,219 @@
+// Package metrics contains the Prometheus collectors exposed via the API's
+// /metrics endpoint. It is independent of the telemetry provider so that
+// metrics are available even without New Relic or an OTel collector.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	AckActionAck     = "ack"
+	AckActionNack    = "nack"
+	AckActionRequeue = "requeue"
+	AckActionReject  = "reject"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests    *prometheus.CounterVec
+	HTTPDuration    *prometheus.HistogramVec
+	HTTPInFlight    prometheus.Gauge
+	HTTPRateLimited *prometheus.CounterVec
+
+	ConsumerMessages *prometheus.CounterVec
+	ConsumerDuration *prometheus.HistogramVec
+	ConsumerAcks     *prometheus.CounterVec
+	ConsumerErrors   *prometheus.CounterVec
+	ConsumerInFlight *prometheus.GaugeVec
+
+	RabbitReconnects *prometheus.CounterVec
+
+	HealthTransitions *prometheus.CounterVec
+
+	TLSCertExpiry *prometheus.GaugeVec
+
+	BuildInfo *prometheus.GaugeVec
+}
+
+// New creates all collectors and registers them (along with Go runtime and
+// process collectors) in a dedicated registry. Namespace is used as the metric
+// name prefix; dashes are converted to underscores.
+func New(namespace string) *Metrics {
+	namespace = strings.ReplaceAll(namespace, "-", "_")
+
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests handled, by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+
+		HTTPRateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "rate_limited_total",
+			Help:      "Number of HTTP requests rejected by the rate limiter, by route.",
+		}, []string{"route"}),
+
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests currently being handled.",
+		}),
+
+		ConsumerMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "messages_total",
+			Help:      "Number of messages consumed, by consumer.",
+		}, []string{"consumer"}),
+
+		ConsumerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "handler_duration_seconds",
+			Help:      "Consumer handler latency, by consumer.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"consumer"}),
+
+		ConsumerAcks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "acks_total",
+			Help:      "Number of message acknowledgements, by consumer and action (ack, nack, requeue, reject).",
+		}, []string{"consumer", "action"}),
+
+		ConsumerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "errors_total",
+			Help:      "Number of consumer handler errors, by consumer.",
+		}, []string{"consumer"}),
+
+		ConsumerInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "consumer",
+			Name:      "in_flight",
+			Help:      "Number of messages currently being handled, by consumer.",
+		}, []string{"consumer"}),
+
+		RabbitReconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "rabbit",
+			Name:      "reconnects_total",
+			Help:      "Number of successful reconnects to RabbitMQ, by backend.",
+		}, []string{"backend"}),
+
+		HealthTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "health",
+			Name:      "transitions_total",
+			Help:      "Number of health check state transitions, by check and transition (failed, recovered).",
+		}, []string{"check", "transition"}),
+
+		TLSCertExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "tls",
+			Name:      "cert_expiry_timestamp_seconds",
+			Help:      "Expiry (unix time) of the currently served TLS certificate, by listener.",
+		}, []string{"listener"}),
+
+		BuildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "build_info",
+			Help:      "Always 1; labels describe the running build.",
+		}, []string{"version", "revision", "dirty", "go_version", "service", "env"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPDuration,
+		m.HTTPInFlight,
+		m.HTTPRateLimited,
+		m.ConsumerMessages,
+		m.ConsumerDuration,
+		m.ConsumerAcks,
+		m.ConsumerErrors,
+		m.ConsumerInFlight,
+		m.RabbitReconnects,
+		m.HealthTransitions,
+		m.TLSCertExpiry,
+		m.BuildInfo,
+	)
+
+	return m
+}
+
+// Handler returns the HTTP handler that serves the registry in the Prometheus
+// exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{
+		Registry: m.Registry,
+	})
+}
+
+// WrapHandler instruments an HTTP handler with request count, latency and
+// in-flight metrics; route should be the route pattern, not the actual path.
+func (m *Metrics) WrapHandler(method, route string, h http.Handler) http.Handler {
+	duration := m.HTTPDuration.WithLabelValues(route, method)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		m.HTTPInFlight.Inc()
+		defer m.HTTPInFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+
+		duration.Observe(time.Since(started).Seconds())
+		m.HTTPRequests.WithLabelValues(route, method, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+// statusRecorder captures the status code written by a wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush is needed for handlers that stream (pprof, SSE)
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("Metrics", func() {
+	var m *Metrics
+
+	BeforeEach(func() {
+		m = New("go-svc-template")
+	})
+
+	Describe("WrapHandler", func() {
+		Context("when a wrapped handler is called", func() {
+			It("should count the request by route, method and status", func() {
+				h := m.WrapHandler(http.MethodGet, "/things/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusTeapot)
+				}))
+
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/1", nil))
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/2", nil))
+
+				Expect(testutil.ToFloat64(m.HTTPRequests.WithLabelValues("/things/:id", http.MethodGet, "418"))).To(Equal(2.0))
+				Expect(testutil.ToFloat64(m.HTTPInFlight)).To(Equal(0.0))
+			})
+		})
+	})
+
+	Describe("Handler", func() {
+		Context("when scraped", func() {
+			It("should expose runtime and service metrics", func() {
+				m.RabbitReconnects.WithLabelValues("main").Inc()
+				m.BuildInfo.WithLabelValues("v1.2.3", "abc", "false", "go1.22", "svc", "dev").Set(1)
+
+				rec := httptest.NewRecorder()
+				m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Body.String()).To(ContainSubstring("go_goroutines"))
+				Expect(rec.Body.String()).To(ContainSubstring(`go_svc_template_rabbit_reconnects_total{backend="main"} 1`))
+				Expect(rec.Body.String()).To(ContainSubstring(`go_svc_template_build_info{dirty="false",env="dev",go_version="go1.22",revision="abc",service="svc",version="v1.2.3"} 1`))
+			})
+		})
+	})
+})
@@ -0,0 +1,104 @@
+// Package ratelimit implements fixed-window rate limiting with a pluggable
+// store: MemoryStore keeps counters in-process, CacheStore keeps them in a
+// cache.ICache so that they can be shared by a cache backend that is shared.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Store counts hits per key and window
+type Store interface {
+	// Incr increments the counter for key in the current window and returns
+	// the new count and when the window ends
+	Incr(key string, window time.Duration) (count int, resetAt time.Time, err error)
+}
+
+// Rule allows Limit requests per Window; a Limit <= 0 disables limiting
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRule parses "<limit>/<window>", ie. "100/1m"
+func ParseRule(s string) (Rule, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rule{}, fmt.Errorf("rule '%s' must be in the format <limit>/<window> (ie. 100/1m)", s)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("rule '%s' has an invalid limit", s)
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || window < time.Second {
+		return Rule{}, fmt.Errorf("rule '%s' has an invalid window (must be a duration >= 1s)", s)
+	}
+
+	return Rule{Limit: limit, Window: window}, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// RetryAfter returns how long the client should wait before retrying
+func (r *Result) RetryAfter() time.Duration {
+	d := time.Until(r.ResetAt)
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+type Limiter struct {
+	store Store
+}
+
+func New(store Store) (*Limiter, error) {
+	if store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+
+	return &Limiter{store: store}, nil
+}
+
+// Allow counts a hit for key under rule; scope separates the counters of
+// different rules (ie. the route)
+func (l *Limiter) Allow(scope, key string, rule Rule) (*Result, error) {
+	if rule.Limit <= 0 {
+		return &Result{Allowed: true}, nil
+	}
+
+	count, resetAt, err := l.store.Incr(scope+"|"+key, rule.Window)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to increment rate limit counter")
+	}
+
+	remaining := rule.Limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Result{
+		Allowed:   count <= rule.Limit,
+		Limit:     rule.Limit,
+		Remaining: remaining,
+		ResetAt:   resetAt,
+	}, nil
+}
@@ -0,0 +1,13 @@
+package ratelimit
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRatelimitSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Ratelimit Suite")
+}
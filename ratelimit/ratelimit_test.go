@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/streamdal/go-svc-template/backends/cache"
+)
+
+var _ = Describe("Ratelimit", func() {
+	Describe("ParseRule", func() {
+		It("should parse valid rules", func() {
+			rule, err := ParseRule("100/1m")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rule).To(Equal(Rule{Limit: 100, Window: time.Minute}))
+			Expect(rule.String()).To(Equal("100/1m0s"))
+
+			rule, err = ParseRule("0/1s")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rule.Limit).To(Equal(0))
+		})
+
+		It("should reject invalid rules", func() {
+			for _, s := range []string{"", "100", "x/1m", "-1/1m", "100/x", "100/10ms"} {
+				_, err := ParseRule(s)
+				Expect(err).To(HaveOccurred(), s)
+			}
+		})
+	})
+
+	Describe("Limiter", func() {
+		var (
+			store *MemoryStore
+			l     *Limiter
+		)
+
+		BeforeEach(func() {
+			var err error
+
+			store = NewMemoryStore()
+			l, err = New(store)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should allow up to the limit per scope and key", func() {
+			rule := Rule{Limit: 2, Window: 24 * time.Hour}
+
+			for i := 0; i < 2; i++ {
+				res, err := l.Allow("/route", "ip:1.2.3.4", rule)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.Allowed).To(BeTrue())
+				Expect(res.Remaining).To(Equal(1 - i))
+			}
+
+			res, err := l.Allow("/route", "ip:1.2.3.4", rule)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Allowed).To(BeFalse())
+			Expect(res.Remaining).To(Equal(0))
+			Expect(res.RetryAfter()).To(BeNumerically(">", 0))
+			Expect(res.RetryAfter()).To(BeNumerically("<=", 24*time.Hour))
+
+			res, _ = l.Allow("/route", "ip:5.6.7.8", rule)
+			Expect(res.Allowed).To(BeTrue())
+
+			res, _ = l.Allow("/other", "ip:1.2.3.4", rule)
+			Expect(res.Allowed).To(BeTrue())
+		})
+
+		It("should allow everything for a zero limit", func() {
+			for i := 0; i < 10; i++ {
+				res, err := l.Allow("/route", "key", Rule{Limit: 0, Window: time.Minute})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.Allowed).To(BeTrue())
+			}
+		})
+
+		It("should reset counters once the window ends", func() {
+			rule := Rule{Limit: 1, Window: time.Second}
+
+			res, _ := l.Allow("/route", "key", rule)
+			Expect(res.Allowed).To(BeTrue())
+
+			Eventually(func() bool {
+				res, _ := l.Allow("/route", "key", rule)
+				return res.Allowed
+			}, 3*time.Second, 100*time.Millisecond).Should(BeTrue())
+		})
+
+		It("should require a store", func() {
+			_, err := New(nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("CacheStore", func() {
+		It("should count in the cache", func() {
+			c, err := cache.New()
+			Expect(err).ToNot(HaveOccurred())
+
+			store, err := NewCacheStore(c)
+			Expect(err).ToNot(HaveOccurred())
+
+			for i := 1; i <= 3; i++ {
+				count, resetAt, err := store.Incr("/route|key", 24*time.Hour)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(count).To(Equal(i))
+				Expect(resetAt).To(BeTemporally(">", time.Now()))
+			}
+
+			keys := c.Keys(CacheKeyPrefix)
+			Expect(keys).To(HaveLen(1))
+
+			_, expiresAt, ok := c.GetWithExpiration(keys[0])
+			Expect(ok).To(BeTrue())
+			Expect(expiresAt.IsZero()).To(BeFalse())
+		})
+
+		It("should require a cache", func() {
+			_, err := NewCacheStore(nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
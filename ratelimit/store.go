@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/streamdal/go-svc-template/backends/cache"
+)
+
+// CacheKeyPrefix is the prefix of all keys written by CacheStore
+const CacheKeyPrefix = "ratelimit/"
+
+// memorySweepInterval is how often expired windows are removed
+const memorySweepInterval = time.Minute
+
+type memoryWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// MemoryStore keeps counters in-process
+type MemoryStore struct {
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+	mtx       *sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		windows:   make(map[string]*memoryWindow),
+		lastSweep: time.Now(),
+		mtx:       &sync.Mutex{},
+	}
+}
+
+func (m *MemoryStore) Incr(key string, window time.Duration) (int, time.Time, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(m.lastSweep) > memorySweepInterval {
+		m.sweep(now)
+	}
+
+	w, ok := m.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &memoryWindow{resetAt: windowEnd(now, window)}
+		m.windows[key] = w
+	}
+
+	w.count++
+
+	return w.count, w.resetAt, nil
+}
+
+// sweep must be called with m.mtx held
+func (m *MemoryStore) sweep(now time.Time) {
+	for k, w := range m.windows {
+		if !now.Before(w.resetAt) {
+			delete(m.windows, k)
+		}
+	}
+
+	m.lastSweep = now
+}
+
+// CacheStore keeps counters in a cache.ICache. ICache has no atomic increment,
+// so increments are serialized per process; with a cache that is shared
+// between pods the limit is best-effort (concurrent increments may be lost).
+type CacheStore struct {
+	cache cache.ICache
+	mtx   *sync.Mutex
+}
+
+func NewCacheStore(c cache.ICache) (*CacheStore, error) {
+	if c == nil {
+		return nil, errors.New("cache cannot be nil")
+	}
+
+	return &CacheStore{
+		cache: c,
+		mtx:   &sync.Mutex{},
+	}, nil
+}
+
+func (c *CacheStore) Incr(key string, window time.Duration) (int, time.Time, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Fixed windows are aligned so that all pods agree on the window
+	resetAt := windowEnd(time.Now(), window)
+	cacheKey := CacheKeyPrefix + key + "|" + resetAt.UTC().Format(time.RFC3339)
+
+	count := 0
+
+	if v, ok := c.cache.Get(cacheKey); ok {
+		n, ok := v.(int)
+		if !ok {
+			return 0, time.Time{}, errors.Errorf("unexpected value type %T for key '%s'", v, cacheKey)
+		}
+
+		count = n
+	}
+
+	count++
+
+	// Keep the key a little longer than the window to tolerate clock skew
+	c.cache.SetWithTTL(cacheKey, count, time.Until(resetAt)+window)
+
+	return count, resetAt, nil
+}
+
+// windowEnd returns the end of the window (aligned to the unix epoch) that
+// contains now
+func windowEnd(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window).Add(window)
+}
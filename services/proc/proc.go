@@ -5,16 +5,21 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/streamdal/rabbit"
 	"go.uber.org/zap"
 
 	"github.com/streamdal/go-svc-template/backends/cache"
+	"github.com/streamdal/go-svc-template/backends/rabbitinfo"
 	"github.com/streamdal/go-svc-template/clog"
 	"github.com/streamdal/go-svc-template/config"
+	"github.com/streamdal/go-svc-template/metrics"
+	"github.com/streamdal/go-svc-template/telemetry"
 )
 
 const (
@@ -23,26 +28,47 @@ const (
 
 type IProc interface {
 	StartConsumers() error
+	Started() bool
+	Paused() bool
+	Status() map[string]*ConsumerStatus
+	InspectQueue(name string) (*rabbitinfo.Queue, error)
+	Inspect() map[string]*Inspection
+	InspectConsumer(name string) (*Inspection, error)
+	SetNumConsumers(name string, n int) error
+	SubscribeTail(filter *TailFilter) (*TailSubscription, error)
 }
 
 type Options struct {
 	RabbitMap map[string]*RabbitConfig
 	Cache     cache.ICache
 	Log       clog.ICustomLog
-	NewRelic  *newrelic.Application
+	Telemetry telemetry.ITelemetry
+	Metrics   *metrics.Metrics
 }
 
 type RabbitConfig struct {
 	RabbitInstance rabbit.IRabbit
-	NumConsumers   int
-	Func           string
-	funcReal       func(amqp.Delivery) error // filled out during New()
+
+	// NumConsumers can be changed at runtime via SetNumConsumers()
+	NumConsumers int
+	Func         string
+	funcReal     func(amqp.Delivery) error // filled out during New()
+	running      atomic.Int32              // number of running worker goroutines
+	lastProgress atomic.Int64              // unix nano of last handled message (or start)
+	workers      atomic.Pointer[[]*worker] // filled out during StartConsumers()
+	nextWorkerID int
+	mtx          sync.Mutex // guards NumConsumers, workers (writes) and nextWorkerID
 }
 
 type Proc struct {
 	config  *config.Config
 	options *Options
 	log     clog.ICustomLog
+	started atomic.Bool
+	tail    *Tail
+
+	// consumerErrCh is shared by all workers; set by StartConsumers()
+	consumerErrCh chan *rabbit.ConsumeError
 }
 
 func New(opt *Options, cfg *config.Config) (*Proc, error) {
@@ -58,6 +84,7 @@ func New(opt *Options, cfg *config.Config) (*Proc, error) {
 	i := &Proc{
 		config:  cfg,
 		options: opt,
+		tail:    NewTail(cfg.TailMaxSubscribers, cfg.TailBufferSize, cfg.TailMaxBodyBytes),
 	}
 
 	if err := i.validateOptions(opt); err != nil {
@@ -78,17 +105,25 @@ func (p *Proc) validateOptions(opts *Options) error {
 		return errors.New("Log cannot be nil")
 	}
 
+	if opts.Telemetry == nil {
+		opts.Telemetry = &telemetry.Noop{}
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.New(p.config.ServiceName)
+	}
+
 	if len(opts.RabbitMap) == 0 {
 		return errors.New("Rabbit map cannot be empty")
 	}
 
 	for name, c := range opts.RabbitMap {
 		if c.RabbitInstance == nil {
-			return fmt.Errorf("rabbit instance for '%p' cannot be nil", name)
+			return fmt.Errorf("rabbit instance for '%s' cannot be nil", name)
 		}
 
 		if c.Func == "" {
-			return fmt.Errorf("func for '%p' cannot be nil", name)
+			return fmt.Errorf("func for '%s' cannot be nil", name)
 		}
 
 		if c.NumConsumers < 1 {
@@ -99,37 +134,214 @@ func (p *Proc) validateOptions(opts *Options) error {
 		method := reflect.ValueOf(p).MethodByName(c.Func)
 
 		if !method.IsValid() {
-			return fmt.Errorf("method for '%p' appears to be invalid", c.Func)
+			return fmt.Errorf("method for '%s' appears to be invalid", c.Func)
 		}
 
 		f, ok := method.Interface().(func(amqp.Delivery) error)
 		if !ok {
-			return fmt.Errorf("unable to type assert method '%p'", c.Func)
+			return fmt.Errorf("unable to type assert method '%s'", c.Func)
 		}
 
-		opts.RabbitMap[name].funcReal = f
+		opts.RabbitMap[name].funcReal = p.instrument(name, c, f)
 	}
 
 	return nil
 }
 
+// instrument wraps a consumer func so that every delivery is recorded as a
+// telemetry transaction and counted in metrics (under the RabbitMap entry name)
+func (p *Proc) instrument(consumer string, c *RabbitConfig, f func(amqp.Delivery) error) func(amqp.Delivery) error {
+	m := p.options.Metrics
+
+	messages := m.ConsumerMessages.WithLabelValues(consumer)
+	duration := m.ConsumerDuration.WithLabelValues(consumer)
+	errCount := m.ConsumerErrors.WithLabelValues(consumer)
+	inFlight := m.ConsumerInFlight.WithLabelValues(consumer)
+
+	return func(msg amqp.Delivery) error {
+		started := time.Now()
+
+		messages.Inc()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		_, txn := p.options.Telemetry.StartTransaction(context.Background(), c.Func, telemetry.WithHeaders(msg.Headers))
+		defer txn.End()
+
+		txn.SetAttribute("consumer", consumer)
+		txn.SetAttribute("routingKey", msg.RoutingKey)
+		txn.SetAttribute("exchange", msg.Exchange)
+
+		var acker *countingAcknowledger
+
+		if msg.Acknowledger != nil {
+			acker = &countingAcknowledger{
+				Acknowledger: msg.Acknowledger,
+				metrics:      m,
+				consumer:     consumer,
+			}
+
+			msg.Acknowledger = acker
+		}
+
+		err := f(msg)
+
+		latency := time.Since(started)
+
+		duration.Observe(latency.Seconds())
+		c.lastProgress.Store(time.Now().UnixNano())
+
+		if err != nil {
+			errCount.Inc()
+			txn.NoticeError(err)
+		}
+
+		if p.tail.Active() {
+			action := ""
+
+			if acker != nil {
+				action = acker.Action()
+			}
+
+			p.tail.Publish(p.tail.newEvent(consumer, &msg, action, err, latency))
+		}
+
+		return err
+	}
+}
+
+// SubscribeTail returns a live view of deliveries matching filter; the
+// subscription must be closed when done
+func (p *Proc) SubscribeTail(filter *TailFilter) (*TailSubscription, error) {
+	return p.tail.Subscribe(filter)
+}
+
 func (p *Proc) StartConsumers() error {
 	logger := p.log.With(zap.String("method", "StartConsumers"))
-	consumerErrCh := make(chan *rabbit.ConsumeError, 1)
+	p.consumerErrCh = make(chan *rabbit.ConsumeError, 1)
 
-	go p.runConsumerErrorWatcher(consumerErrCh)
+	go p.runConsumerErrorWatcher(p.consumerErrCh)
 
 	for name, r := range p.options.RabbitMap {
+		r.mtx.Lock()
+
 		logger.Debug("Launching proc consumers", zap.Int("numConsumers", r.NumConsumers), zap.String("entryName", name))
 
-		for n := 0; n < r.NumConsumers; n++ {
-			go r.RabbitInstance.Consume(context.Background(), consumerErrCh, r.funcReal)
-		}
+		r.lastProgress.Store(time.Now().UnixNano())
+		r.workers.Store(&[]*worker{})
+		p.scale(r, r.NumConsumers)
+
+		r.mtx.Unlock()
 	}
 
+	p.started.Store(true)
+
 	return nil
 }
 
+// SetNumConsumers changes the number of consumer goroutines of the named
+// RabbitMap entry. Extra workers finish the delivery they are handling (if
+// any) before exiting.
+func (p *Proc) SetNumConsumers(name string, n int) error {
+	r, ok := p.options.RabbitMap[name]
+	if !ok {
+		return fmt.Errorf("%w '%s'", ErrUnknownConsumer, name)
+	}
+
+	if n < 1 {
+		return fmt.Errorf("number of consumers must be at least 1 (got %d)", n)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	p.log.Info("changing number of consumers", zap.String("entryName", name),
+		zap.Int("from", r.NumConsumers), zap.Int("to", n))
+
+	r.NumConsumers = n
+
+	// StartConsumers() launches NumConsumers workers
+	if workers := r.workers.Load(); workers != nil {
+		p.scale(r, n)
+	}
+
+	return nil
+}
+
+// scale starts or stops workers until there are n; r.mtx must be held
+func (p *Proc) scale(r *RabbitConfig, n int) {
+	current := *r.workers.Load()
+	workers := make([]*worker, 0, n)
+
+	if n <= len(current) {
+		workers = append(workers, current[:n]...)
+
+		for _, w := range current[n:] {
+			w.stop()
+		}
+	} else {
+		workers = append(workers, current...)
+
+		for len(workers) < n {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			w := newWorker(r.nextWorkerID)
+			w.cancel = cancel
+			r.nextWorkerID++
+
+			workers = append(workers, w)
+
+			r.running.Add(1)
+			go p.runConsumer(ctx, r, w, p.consumerErrCh)
+		}
+	}
+
+	r.workers.Store(&workers)
+}
+
+// runConsumer handles one delivery at a time until ctx is done or the rabbit
+// backend is stopped; r.running must be incremented by the caller.
+//
+// Consume() is not used since all of its callers share a single loop: it is
+// not possible to stop one consumer without stopping all of them.
+func (p *Proc) runConsumer(ctx context.Context, r *RabbitConfig, w *worker, errCh chan *rabbit.ConsumeError) {
+	defer r.running.Add(-1)
+	defer w.setState(WorkerStateExited)
+
+	f := w.wrap(r.funcReal)
+
+	for ctx.Err() == nil {
+		handled := false
+
+		err := r.RabbitInstance.ConsumeOnce(ctx, func(msg amqp.Delivery) error {
+			handled = true
+
+			if err := f(msg); err != nil {
+				// Same as Consume(): write in a goroutine in case errCh is
+				// not read fast enough
+				go func() {
+					errCh <- &rabbit.ConsumeError{
+						Message: &msg,
+						Error:   err,
+					}
+				}()
+			}
+
+			return nil
+		})
+		if err != nil {
+			p.log.Debug("consumer exiting", zap.Int("worker", w.id), zap.Error(err))
+			return
+		}
+
+		// ConsumeOnce() returns without a delivery once ctx is done or the
+		// backend was stopped
+		if !handled {
+			return
+		}
+	}
+}
+
 func (p *Proc) runConsumerErrorWatcher(errCh chan *rabbit.ConsumeError) {
 	logger := p.log.With(zap.String("method", "runConsumerErrorWatcher"))
 
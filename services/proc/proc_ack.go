@@ -0,0 +1,58 @@
+package proc
+
+import (
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/streamdal/go-svc-template/metrics"
+)
+
+// countingAcknowledger wraps a delivery's acknowledger so that ack/nack/requeue
+// calls made by consumer funcs are counted without the funcs having to know.
+// The last action is recorded for the live tail.
+type countingAcknowledger struct {
+	amqp.Acknowledger
+	metrics  *metrics.Metrics
+	consumer string
+	action   atomic.Value
+}
+
+func (c *countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	c.metrics.ConsumerAcks.WithLabelValues(c.consumer, metrics.AckActionAck).Inc()
+	c.action.Store(metrics.AckActionAck)
+
+	return c.Acknowledger.Ack(tag, multiple)
+}
+
+// Action returns the last ack action ("" if none)
+func (c *countingAcknowledger) Action() string {
+	action, _ := c.action.Load().(string)
+	return action
+}
+
+func (c *countingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	action := metrics.AckActionNack
+
+	if requeue {
+		action = metrics.AckActionRequeue
+	}
+
+	c.metrics.ConsumerAcks.WithLabelValues(c.consumer, action).Inc()
+	c.action.Store(action)
+
+	return c.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (c *countingAcknowledger) Reject(tag uint64, requeue bool) error {
+	action := metrics.AckActionReject
+
+	if requeue {
+		action = metrics.AckActionRequeue
+	}
+
+	c.metrics.ConsumerAcks.WithLabelValues(c.consumer, action).Inc()
+	c.action.Store(action)
+
+	return c.Acknowledger.Reject(tag, requeue)
+}
@@ -25,9 +25,6 @@ func (p *Proc) MainConsumeFunc(msg amqp.Delivery) error {
 		}
 	}()
 
-	txn := p.options.NewRelic.StartTransaction("MainConsumeFunc")
-	defer txn.End()
-
 	// logger.Debug("Received message: " + string(msg.Body))
 
 	// !!!!
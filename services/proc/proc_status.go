@@ -0,0 +1,161 @@
+package proc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/streamdal/go-svc-template/backends/rabbitinfo"
+)
+
+// ErrUnknownConsumer is returned for names that are not in the RabbitMap
+var ErrUnknownConsumer = errors.New("unknown consumer")
+
+// ConsumerStatus describes the state of a single RabbitMap entry (consumer group)
+type ConsumerStatus struct {
+	Name  string `json:"name"`
+	Func  string `json:"func"`
+	Queue string `json:"queue"`
+
+	// NumConsumers is the configured number of consumer goroutines
+	NumConsumers int `json:"num_consumers"`
+
+	// Running is the number of consumer goroutines currently running
+	Running int `json:"running"`
+
+	// Connected is false if the rabbit backend has no usable connection. While
+	// the backend is reconnecting, consumers are effectively paused.
+	Connected bool `json:"connected"`
+
+	// LastProgressAt is when the group last finished handling a message (or
+	// when it was started, if it has not handled anything yet)
+	LastProgressAt time.Time `json:"last_progress_at"`
+}
+
+// Inspection is the detailed state of a RabbitMap entry: local consumer
+// goroutines, the broker connection and the queue as seen by the broker
+type Inspection struct {
+	*ConsumerStatus
+
+	Broker *rabbitinfo.Broker `json:"broker"`
+
+	// Queue is nil if the queue could not be inspected (see QueueError); not
+	// "queue" since that is the queue name from ConsumerStatus
+	Queue      *rabbitinfo.Queue `json:"queue_stats,omitempty"`
+	QueueError string            `json:"queue_error,omitempty"`
+
+	// Workers is empty until consumers are started
+	Workers []*WorkerStatus `json:"workers"`
+}
+
+// Started returns true once StartConsumers() has launched all consumers
+func (p *Proc) Started() bool {
+	return p.started.Load()
+}
+
+// Status returns the status of every RabbitMap entry, keyed by entry name
+func (p *Proc) Status() map[string]*ConsumerStatus {
+	status := make(map[string]*ConsumerStatus, len(p.options.RabbitMap))
+
+	for name, r := range p.options.RabbitMap {
+		status[name] = consumerStatus(name, r)
+	}
+
+	return status
+}
+
+func consumerStatus(name string, r *RabbitConfig) *ConsumerStatus {
+	r.mtx.Lock()
+	numConsumers := r.NumConsumers
+	r.mtx.Unlock()
+
+	s := &ConsumerStatus{
+		Name:         name,
+		Func:         r.Func,
+		Queue:        rabbitinfo.QueueName(r.RabbitInstance),
+		NumConsumers: numConsumers,
+		Running:      int(r.running.Load()),
+		Connected:    rabbitinfo.GetState(r.RabbitInstance).Connected,
+	}
+
+	if ts := r.lastProgress.Load(); ts > 0 {
+		s.LastProgressAt = time.Unix(0, ts)
+	}
+
+	return s
+}
+
+// Paused returns true if any consumer group is not running at full capacity
+// (ie. because its rabbit backend is reconnecting)
+func (p *Proc) Paused() bool {
+	if !p.Started() {
+		return false
+	}
+
+	for _, s := range p.Status() {
+		if !s.Connected || s.Running < s.NumConsumers {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InspectQueue fetches the message + consumer count of the queue used by the
+// named RabbitMap entry
+func (p *Proc) InspectQueue(name string) (*rabbitinfo.Queue, error) {
+	r, ok := p.options.RabbitMap[name]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownConsumer, name)
+	}
+
+	return rabbitinfo.InspectQueue(r.RabbitInstance)
+}
+
+// Inspect returns the detailed state of every RabbitMap entry, keyed by entry
+// name. Unlike Status(), this does a round-trip to the broker per entry (a
+// passive queue declare).
+func (p *Proc) Inspect() map[string]*Inspection {
+	inspections := make(map[string]*Inspection, len(p.options.RabbitMap))
+
+	for name, r := range p.options.RabbitMap {
+		inspections[name] = inspect(name, r)
+	}
+
+	return inspections
+}
+
+// InspectConsumer is Inspect() for a single RabbitMap entry; only that
+// entry's queue is declared
+func (p *Proc) InspectConsumer(name string) (*Inspection, error) {
+	r, ok := p.options.RabbitMap[name]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownConsumer, name)
+	}
+
+	return inspect(name, r), nil
+}
+
+func inspect(name string, r *RabbitConfig) *Inspection {
+	i := &Inspection{
+		ConsumerStatus: consumerStatus(name, r),
+		Broker:         rabbitinfo.GetBroker(r.RabbitInstance),
+		Workers:        make([]*WorkerStatus, 0),
+	}
+
+	q, err := rabbitinfo.InspectQueue(r.RabbitInstance)
+	if err != nil {
+		i.QueueError = err.Error()
+	} else {
+		i.Queue = q
+	}
+
+	if workers := r.workers.Load(); workers != nil {
+		for _, w := range *workers {
+			i.Workers = append(i.Workers, w.status())
+		}
+	}
+
+	return i
+}
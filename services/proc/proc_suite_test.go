@@ -0,0 +1,13 @@
+package proc
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestProcSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Proc Suite")
+}
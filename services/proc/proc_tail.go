@@ -0,0 +1,287 @@
+package proc
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// OutcomeError is used if the consumer func returned an error; otherwise
+	// the outcome is the ack action (see metrics.AckAction*) or OutcomeUnacked
+	OutcomeError   = "error"
+	OutcomeUnacked = "unacked"
+
+	DefaultTailBufferSize   = 100
+	DefaultTailMaxBodyBytes = 1024
+)
+
+var ErrTooManySubscribers = errors.New("too many tail subscribers")
+
+// DeliveryEvent describes a single delivery handled by a consumer func
+type DeliveryEvent struct {
+	Consumer      string            `json:"consumer"`
+	Exchange      string            `json:"exchange"`
+	RoutingKey    string            `json:"routing_key"`
+	MessageID     string            `json:"message_id,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body"`
+	BodySize      int               `json:"body_size"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	Outcome       string            `json:"outcome"`
+	AckAction     string            `json:"ack_action,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	LatencyMs     float64           `json:"latency_ms"`
+	Timestamp     time.Time         `json:"timestamp"`
+}
+
+// TailFilter selects the deliveries a subscriber receives; empty fields match
+// everything
+type TailFilter struct {
+	Consumer string
+
+	// RoutingKey is an AMQP topic pattern (* matches one word, # zero or more)
+	RoutingKey string
+
+	// Headers must all be present with the given value (compared as strings)
+	Headers map[string]string
+
+	Outcomes []string
+
+	// SampleRate is the fraction (0..1] of matching deliveries to receive;
+	// 0 means all
+	SampleRate float64
+}
+
+// TailSubscription receives delivery events until Close() is called. Events
+// are dropped (and counted) instead of blocking consumers when C is full.
+type TailSubscription struct {
+	C <-chan *DeliveryEvent
+
+	ch      chan *DeliveryEvent
+	filter  *TailFilter
+	dropped atomic.Uint64
+	tail    *Tail
+	once    sync.Once
+}
+
+// Dropped returns the number of events dropped because C was full
+func (s *TailSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *TailSubscription) Close() {
+	s.once.Do(func() {
+		s.tail.unsubscribe(s)
+	})
+}
+
+// Tail fans out delivery events to subscribers. Publishing never blocks and
+// costs (almost) nothing while there are no subscribers.
+type Tail struct {
+	maxSubscribers int
+	bufferSize     int
+	maxBodyBytes   int
+
+	subs   map[*TailSubscription]struct{}
+	active atomic.Int32
+	mtx    *sync.RWMutex
+}
+
+func NewTail(maxSubscribers, bufferSize, maxBodyBytes int) *Tail {
+	if bufferSize < 1 {
+		bufferSize = DefaultTailBufferSize
+	}
+
+	if maxBodyBytes < 0 {
+		maxBodyBytes = DefaultTailMaxBodyBytes
+	}
+
+	return &Tail{
+		maxSubscribers: maxSubscribers,
+		bufferSize:     bufferSize,
+		maxBodyBytes:   maxBodyBytes,
+		subs:           make(map[*TailSubscription]struct{}),
+		mtx:            &sync.RWMutex{},
+	}
+}
+
+// Subscribe returns a subscription for deliveries matching filter
+func (t *Tail) Subscribe(filter *TailFilter) (*TailSubscription, error) {
+	if filter == nil {
+		filter = &TailFilter{}
+	}
+
+	if filter.SampleRate < 0 || filter.SampleRate > 1 {
+		return nil, errors.New("sample rate must be between 0 and 1")
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if len(t.subs) >= t.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	ch := make(chan *DeliveryEvent, t.bufferSize)
+
+	sub := &TailSubscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+		tail:   t,
+	}
+
+	t.subs[sub] = struct{}{}
+	t.active.Store(int32(len(t.subs)))
+
+	return sub, nil
+}
+
+func (t *Tail) unsubscribe(sub *TailSubscription) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.subs, sub)
+	t.active.Store(int32(len(t.subs)))
+}
+
+// Active returns true if there is at least one subscriber
+func (t *Tail) Active() bool {
+	return t.active.Load() > 0
+}
+
+// Publish sends the event to every matching subscriber without blocking
+func (t *Tail) Publish(event *DeliveryEvent) {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	for sub := range t.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+
+		if sub.filter.SampleRate > 0 && sub.filter.SampleRate < 1 && rand.Float64() >= sub.filter.SampleRate {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// newEvent builds an event for a delivery; the body is truncated to
+// maxBodyBytes
+func (t *Tail) newEvent(consumer string, msg *amqp.Delivery, ackAction string, err error, latency time.Duration) *DeliveryEvent {
+	event := &DeliveryEvent{
+		Consumer:   consumer,
+		Exchange:   msg.Exchange,
+		RoutingKey: msg.RoutingKey,
+		MessageID:  msg.MessageId,
+		BodySize:   len(msg.Body),
+		Outcome:    OutcomeUnacked,
+		AckAction:  ackAction,
+		LatencyMs:  float64(latency.Microseconds()) / 1000,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	body := msg.Body
+
+	if len(body) > t.maxBodyBytes {
+		body = body[:t.maxBodyBytes]
+		event.BodyTruncated = true
+	}
+
+	event.Body = string(body)
+
+	if len(msg.Headers) > 0 {
+		event.Headers = make(map[string]string, len(msg.Headers))
+
+		for k, v := range msg.Headers {
+			event.Headers[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	if ackAction != "" {
+		event.Outcome = ackAction
+	}
+
+	if err != nil {
+		event.Outcome = OutcomeError
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// Matches returns true if the event passes the filter (sampling aside)
+func (f *TailFilter) Matches(event *DeliveryEvent) bool {
+	if f.Consumer != "" && f.Consumer != event.Consumer {
+		return false
+	}
+
+	if f.RoutingKey != "" && !MatchTopic(f.RoutingKey, event.RoutingKey) {
+		return false
+	}
+
+	for k, v := range f.Headers {
+		if hv, ok := event.Headers[k]; !ok || hv != v {
+			return false
+		}
+	}
+
+	if len(f.Outcomes) == 0 {
+		return true
+	}
+
+	for _, o := range f.Outcomes {
+		if o == event.Outcome {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchTopic matches a routing key against an AMQP topic pattern
+func MatchTopic(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+// matchWords fills in, one pattern word at a time from the end, which
+// suffixes of key match the remaining pattern. Unlike plain backtracking this
+// stays O(len(pattern) * len(key)) however many '#' the pattern contains.
+func matchWords(pattern, key []string) bool {
+	// next[j] is true if pattern[i+1:] matches key[j:]
+	next := make([]bool, len(key)+1)
+	next[len(key)] = true
+
+	for i := len(pattern) - 1; i >= 0; i-- {
+		cur := make([]bool, len(key)+1)
+
+		for j := len(key); j >= 0; j-- {
+			switch pattern[i] {
+			case "#":
+				// # matches zero or more words
+				cur[j] = next[j] || (j < len(key) && cur[j+1])
+			case "*":
+				cur[j] = j < len(key) && next[j+1]
+			default:
+				cur[j] = j < len(key) && pattern[i] == key[j] && next[j+1]
+			}
+		}
+
+		next = cur
+	}
+
+	return next[0]
+}
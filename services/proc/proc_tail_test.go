@@ -0,0 +1,151 @@
+package proc
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/streamdal/go-svc-template/metrics"
+)
+
+var _ = Describe("Tail", func() {
+	var tail *Tail
+
+	BeforeEach(func() {
+		tail = NewTail(2, 1, 4)
+	})
+
+	Describe("MatchTopic", func() {
+		It("should match AMQP topic patterns", func() {
+			Expect(MatchTopic("orders.created", "orders.created")).To(BeTrue())
+			Expect(MatchTopic("orders.*", "orders.created")).To(BeTrue())
+			Expect(MatchTopic("orders.*", "orders.eu.created")).To(BeFalse())
+			Expect(MatchTopic("orders.#", "orders.eu.created")).To(BeTrue())
+			Expect(MatchTopic("orders.#", "orders")).To(BeTrue())
+			Expect(MatchTopic("#.created", "orders.eu.created")).To(BeTrue())
+			Expect(MatchTopic("#", "anything.at.all")).To(BeTrue())
+			Expect(MatchTopic("orders.*", "users.created")).To(BeFalse())
+			Expect(MatchTopic("#.#", "")).To(BeTrue())
+			Expect(MatchTopic("#.*.#", "orders")).To(BeTrue())
+			Expect(MatchTopic("orders.#.created.#", "orders.eu.created.v1")).To(BeTrue())
+			Expect(MatchTopic("orders.#.created", "orders.eu.updated")).To(BeFalse())
+		})
+
+		It("should not backtrack exponentially on repeated #", func() {
+			pattern := strings.TrimSuffix(strings.Repeat("#.", 32), ".") + ".x"
+			key := strings.TrimSuffix(strings.Repeat("a.", 128), ".")
+
+			started := time.Now()
+
+			Expect(MatchTopic(pattern, key)).To(BeFalse())
+			Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("Matches", func() {
+		event := &DeliveryEvent{
+			Consumer:   "main",
+			RoutingKey: "orders.created",
+			Headers:    map[string]string{"tenant": "acme"},
+			Outcome:    metrics.AckActionNack,
+		}
+
+		It("should match everything with an empty filter", func() {
+			Expect((&TailFilter{}).Matches(event)).To(BeTrue())
+		})
+
+		It("should require every field to match", func() {
+			filter := &TailFilter{
+				Consumer:   "main",
+				RoutingKey: "orders.*",
+				Headers:    map[string]string{"tenant": "acme"},
+				Outcomes:   []string{OutcomeError, metrics.AckActionNack},
+			}
+
+			Expect(filter.Matches(event)).To(BeTrue())
+
+			filter.Headers["tenant"] = "other"
+			Expect(filter.Matches(event)).To(BeFalse())
+		})
+
+		It("should filter by outcome", func() {
+			Expect((&TailFilter{Outcomes: []string{OutcomeError}}).Matches(event)).To(BeFalse())
+		})
+	})
+
+	Describe("Subscribe", func() {
+		It("should limit the number of subscribers", func() {
+			sub1, err := tail.Subscribe(nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = tail.Subscribe(nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = tail.Subscribe(nil)
+			Expect(err).To(Equal(ErrTooManySubscribers))
+
+			sub1.Close()
+			sub1.Close()
+
+			_, err = tail.Subscribe(nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should reject invalid sample rates", func() {
+			_, err := tail.Subscribe(&TailFilter{SampleRate: 1.5})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Publish", func() {
+		It("should drop events instead of blocking", func() {
+			Expect(tail.Active()).To(BeFalse())
+
+			sub, err := tail.Subscribe(&TailFilter{RoutingKey: "orders.#"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tail.Active()).To(BeTrue())
+
+			tail.Publish(&DeliveryEvent{RoutingKey: "orders.created"})
+			tail.Publish(&DeliveryEvent{RoutingKey: "orders.updated"})
+			tail.Publish(&DeliveryEvent{RoutingKey: "users.created"})
+
+			Expect((<-sub.C).RoutingKey).To(Equal("orders.created"))
+			Expect(sub.Dropped()).To(Equal(uint64(1)))
+
+			sub.Close()
+			Expect(tail.Active()).To(BeFalse())
+		})
+	})
+
+	Describe("newEvent", func() {
+		msg := &amqp.Delivery{
+			RoutingKey: "orders.created",
+			Headers:    amqp.Table{"attempt": int32(2)},
+			Body:       []byte("hello world"),
+		}
+
+		It("should truncate the body", func() {
+			event := tail.newEvent("main", msg, metrics.AckActionAck, nil, time.Millisecond)
+
+			Expect(event.Body).To(Equal("hell"))
+			Expect(event.BodySize).To(Equal(11))
+			Expect(event.BodyTruncated).To(BeTrue())
+			Expect(event.Headers).To(Equal(map[string]string{"attempt": "2"}))
+			Expect(event.Outcome).To(Equal(metrics.AckActionAck))
+			Expect(event.LatencyMs).To(Equal(1.0))
+		})
+
+		It("should set the outcome", func() {
+			Expect(tail.newEvent("main", msg, "", nil, 0).Outcome).To(Equal(OutcomeUnacked))
+
+			event := tail.newEvent("main", msg, metrics.AckActionNack, errors.New("boom"), 0)
+			Expect(event.Outcome).To(Equal(OutcomeError))
+			Expect(event.AckAction).To(Equal(metrics.AckActionNack))
+			Expect(event.Error).To(Equal("boom"))
+		})
+	})
+})
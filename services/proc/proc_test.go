@@ -0,0 +1,158 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/streamdal/rabbit"
+
+	"github.com/streamdal/go-svc-template/backends/cache"
+	"github.com/streamdal/go-svc-template/clog"
+	"github.com/streamdal/go-svc-template/config"
+)
+
+var _ = Describe("Proc", func() {
+	var (
+		p  *Proc
+		fr *fakeRabbit
+	)
+
+	BeforeEach(func() {
+		cfg, err := config.Parse("test", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		c, err := cache.New()
+		Expect(err).ToNot(HaveOccurred())
+
+		fr = newFakeRabbit()
+
+		p, err = New(&Options{
+			Cache: c,
+			RabbitMap: map[string]*RabbitConfig{
+				"main": {
+					RabbitInstance: fr,
+					NumConsumers:   2,
+					Func:           "MainConsumeFunc",
+				},
+			},
+			Log: &clog.CustomLogNoop{},
+		}, cfg)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		fr.Stop()
+	})
+
+	running := func() int {
+		return p.Status()["main"].Running
+	}
+
+	Describe("SetNumConsumers", func() {
+		It("should scale workers up and down", func() {
+			Expect(p.StartConsumers()).To(Succeed())
+			Eventually(running).Should(Equal(2))
+
+			Expect(p.SetNumConsumers("main", 5)).To(Succeed())
+			Eventually(running).Should(Equal(5))
+			Expect(p.Status()["main"].NumConsumers).To(Equal(5))
+			Expect(p.Inspect()["main"].Workers).To(HaveLen(5))
+
+			Expect(p.SetNumConsumers("main", 1)).To(Succeed())
+			Eventually(running).Should(Equal(1))
+			Expect(p.Inspect()["main"].Workers).To(HaveLen(1))
+
+			// Remaining worker still consumes
+			fr.deliveries <- amqp.Delivery{}
+			Eventually(func() uint64 {
+				return p.Inspect()["main"].Workers[0].Handled
+			}).Should(Equal(uint64(1)))
+		})
+
+		It("should only change the configured number before consumers are started", func() {
+			Expect(p.SetNumConsumers("main", 3)).To(Succeed())
+			Expect(running()).To(Equal(0))
+
+			Expect(p.StartConsumers()).To(Succeed())
+			Eventually(running).Should(Equal(3))
+		})
+
+		It("should reject unknown consumers and invalid counts", func() {
+			Expect(p.SetNumConsumers("other", 1)).To(MatchError(ContainSubstring("unknown consumer")))
+			Expect(p.SetNumConsumers("main", 0)).ToNot(Succeed())
+		})
+	})
+
+	Describe("InspectConsumer", func() {
+		It("should inspect a single consumer", func() {
+			Expect(p.StartConsumers()).To(Succeed())
+			Eventually(running).Should(Equal(2))
+
+			i, err := p.InspectConsumer("main")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i.Name).To(Equal("main"))
+			Expect(i.Workers).To(HaveLen(2))
+
+			// The fake backend cannot be inspected
+			Expect(i.Queue).To(BeNil())
+			Expect(i.QueueError).ToNot(BeEmpty())
+		})
+
+		It("should reject unknown consumers", func() {
+			_, err := p.InspectConsumer("other")
+			Expect(errors.Is(err, ErrUnknownConsumer)).To(BeTrue())
+			Expect(err).To(MatchError("unknown consumer 'other'"))
+		})
+	})
+
+	It("should stop workers once the backend is stopped", func() {
+		Expect(p.StartConsumers()).To(Succeed())
+		Eventually(running).Should(Equal(2))
+
+		fr.Stop()
+
+		Eventually(running).Should(Equal(0))
+		Expect(p.Paused()).To(BeTrue())
+	})
+})
+
+// fakeRabbit hands out deliveries written to 'deliveries' via ConsumeOnce()
+type fakeRabbit struct {
+	deliveries chan amqp.Delivery
+	stopped    chan struct{}
+	stopOnce   sync.Once
+}
+
+func newFakeRabbit() *fakeRabbit {
+	return &fakeRabbit{
+		deliveries: make(chan amqp.Delivery),
+		stopped:    make(chan struct{}),
+	}
+}
+
+func (f *fakeRabbit) Consume(_ context.Context, _ chan *rabbit.ConsumeError, _ func(msg amqp.Delivery) error) {
+}
+
+func (f *fakeRabbit) ConsumeOnce(ctx context.Context, runFunc func(msg amqp.Delivery) error) error {
+	select {
+	case msg := <-f.deliveries:
+		return runFunc(msg)
+	case <-ctx.Done():
+	case <-f.stopped:
+	}
+
+	return nil
+}
+
+func (f *fakeRabbit) Publish(_ context.Context, _ string, _ []byte) error { return nil }
+
+func (f *fakeRabbit) Stop() error {
+	f.stopOnce.Do(func() { close(f.stopped) })
+	return nil
+}
+
+func (f *fakeRabbit) Close() error { return f.Stop() }
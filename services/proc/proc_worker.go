@@ -0,0 +1,83 @@
+package proc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// WorkerStateIdle means the goroutine is waiting for a delivery (or for
+	// the rabbit lib to finish reconnecting)
+	WorkerStateIdle       = "idle"
+	WorkerStateProcessing = "processing"
+	WorkerStateExited     = "exited"
+)
+
+// WorkerStatus describes a single consumer goroutine of a RabbitMap entry
+type WorkerStatus struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+
+	// Since is when the worker entered its current state
+	Since time.Time `json:"since"`
+
+	// Handled is the number of deliveries the worker has handled
+	Handled uint64 `json:"handled"`
+}
+
+// worker tracks the state of a consumer goroutine
+type worker struct {
+	id      int
+	state   atomic.Value
+	since   atomic.Int64
+	handled atomic.Uint64
+
+	// cancel stops the worker once it has handled the current delivery
+	cancel context.CancelFunc
+}
+
+func newWorker(id int) *worker {
+	w := &worker{id: id}
+	w.setState(WorkerStateIdle)
+
+	return w
+}
+
+func (w *worker) setState(state string) {
+	w.state.Store(state)
+	w.since.Store(time.Now().UnixNano())
+}
+
+// wrap returns f with the worker's state updated around every delivery
+func (w *worker) wrap(f func(amqp.Delivery) error) func(amqp.Delivery) error {
+	return func(msg amqp.Delivery) error {
+		w.setState(WorkerStateProcessing)
+
+		defer func() {
+			w.handled.Add(1)
+			w.setState(WorkerStateIdle)
+		}()
+
+		return f(msg)
+	}
+}
+
+func (w *worker) stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+func (w *worker) status() *WorkerStatus {
+	state, _ := w.state.Load().(string)
+
+	return &WorkerStatus{
+		ID:      w.id,
+		State:   state,
+		Since:   time.Unix(0, w.since.Load()),
+		Handled: w.handled.Load(),
+	}
+}
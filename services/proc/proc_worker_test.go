@@ -0,0 +1,28 @@
+package proc
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var _ = Describe("worker", func() {
+	It("should track its state around deliveries", func() {
+		w := newWorker(3)
+		Expect(w.status().State).To(Equal(WorkerStateIdle))
+
+		f := w.wrap(func(msg amqp.Delivery) error {
+			Expect(w.status().State).To(Equal(WorkerStateProcessing))
+			return errors.New("boom")
+		})
+
+		Expect(f(amqp.Delivery{})).To(MatchError("boom"))
+
+		status := w.status()
+		Expect(status.ID).To(Equal(3))
+		Expect(status.State).To(Equal(WorkerStateIdle))
+		Expect(status.Handled).To(Equal(uint64(1)))
+	})
+})
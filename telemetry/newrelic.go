@@ -0,0 +1,87 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/pkg/errors"
+)
+
+// NewRelic implements ITelemetry on top of the New Relic Go agent
+type NewRelic struct {
+	app *newrelic.Application
+}
+
+type newRelicTransaction struct {
+	txn *newrelic.Transaction
+}
+
+func NewNewRelic(app *newrelic.Application) (*NewRelic, error) {
+	if app == nil {
+		return nil, errors.New("newrelic app cannot be nil")
+	}
+
+	return &NewRelic{
+		app: app,
+	}, nil
+}
+
+func (n *NewRelic) StartTransaction(ctx context.Context, name string, opts ...TransactionOption) (context.Context, ITransaction) {
+	o := newTransactionOptions(opts...)
+
+	txn := n.app.StartTransaction(name)
+
+	if len(o.headers) > 0 {
+		hdrs := http.Header{}
+
+		for k, v := range o.headers {
+			if s, ok := v.(string); ok {
+				hdrs.Set(k, s)
+			}
+		}
+
+		txn.AcceptDistributedTraceHeaders(newrelic.TransportAMQP, hdrs)
+	}
+
+	return newrelic.NewContext(ctx, txn), &newRelicTransaction{txn: txn}
+}
+
+func (n *NewRelic) WrapHandler(method, route string, h http.Handler) http.Handler {
+	name := method + " " + route
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		txn := n.app.StartTransaction(name)
+		defer txn.End()
+
+		txn.SetWebRequestHTTP(r)
+		w = txn.SetWebResponse(w)
+
+		h.ServeHTTP(w, newrelic.RequestWithTransactionContext(r, txn))
+	})
+}
+
+func (n *NewRelic) Shutdown(ctx context.Context) error {
+	timeout := 10 * time.Second
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	n.app.Shutdown(timeout)
+
+	return nil
+}
+
+func (t *newRelicTransaction) SetAttribute(key string, value interface{}) {
+	t.txn.AddAttribute(key, value)
+}
+
+func (t *newRelicTransaction) NoticeError(err error) {
+	t.txn.NoticeError(err)
+}
+
+func (t *newRelicTransaction) End() {
+	t.txn.End()
+}
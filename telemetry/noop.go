@@ -0,0 +1,27 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+)
+
+// This exists to support dependency injection (and running without any
+// telemetry provider configured)
+
+type Noop struct{}
+
+type NoopTransaction struct{}
+
+func (n *Noop) StartTransaction(ctx context.Context, _ string, _ ...TransactionOption) (context.Context, ITransaction) {
+	return ctx, &NoopTransaction{}
+}
+
+func (n *Noop) WrapHandler(_, _ string, h http.Handler) http.Handler { return h }
+
+func (n *Noop) Shutdown(_ context.Context) error { return nil }
+
+func (n *NoopTransaction) SetAttribute(_ string, _ interface{}) {}
+
+func (n *NoopTransaction) NoticeError(_ error) {}
+
+func (n *NoopTransaction) End() {}
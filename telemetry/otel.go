@@ -0,0 +1,421 @@
+package telemetry
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	OTelExporterOTLP   = "otlp"
+	OTelExporterStdout = "stdout"
+	OTelExporterFile   = "file"
+
+	DefaultOTelMetricInterval = 30 * time.Second
+
+	instrumentationName = "github.com/streamdal/go-svc-template"
+)
+
+type OTelOptions struct {
+	ServiceName    string
+	ServiceVersion string
+	EnvName        string
+
+	// Exporter is one of "otlp", "stdout" or "file"
+	Exporter string
+
+	// Endpoint is the OTLP/gRPC collector endpoint (host:port); only used
+	// with the "otlp" exporter
+	Endpoint string
+	Insecure bool
+	Headers  map[string]string
+
+	// FilePath is where spans and metrics are written to when using the
+	// "file" exporter
+	FilePath string
+
+	// SampleRatio is the ratio of root spans that are sampled (0..1)
+	SampleRatio float64
+
+	MetricInterval time.Duration
+}
+
+// OTel implements ITelemetry on top of the OpenTelemetry SDK
+type OTel struct {
+	options        *OTelOptions
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+	file           io.Closer
+
+	httpRequests metric.Int64Counter
+	httpDuration metric.Float64Histogram
+	txnCount     metric.Int64Counter
+	txnDuration  metric.Float64Histogram
+}
+
+type otelTransaction struct {
+	otel    *OTel
+	span    trace.Span
+	name    string
+	started time.Time
+	failed  bool
+}
+
+func NewOTel(opts *OTelOptions) (*OTel, error) {
+	if err := validateOTelOptions(opts); err != nil {
+		return nil, errors.Wrap(err, "unable to validate otel options")
+	}
+
+	o := &OTel{
+		options: opts,
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}
+
+	spanExporter, metricExporter, err := o.newExporters(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create exporters")
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+		semconv.ServiceVersion(opts.ServiceVersion),
+		semconv.DeploymentEnvironment(opts.EnvName),
+	)
+
+	o.tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	o.meterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(opts.MetricInterval))),
+		sdkmetric.WithResource(res),
+	)
+
+	// Register globally so that any library instrumentation picks it up too
+	otel.SetTracerProvider(o.tracerProvider)
+	otel.SetMeterProvider(o.meterProvider)
+	otel.SetTextMapPropagator(o.propagator)
+
+	o.tracer = o.tracerProvider.Tracer(instrumentationName)
+
+	if err := o.setupInstruments(o.meterProvider.Meter(instrumentationName)); err != nil {
+		return nil, errors.Wrap(err, "unable to setup metric instruments")
+	}
+
+	return o, nil
+}
+
+func validateOTelOptions(opts *OTelOptions) error {
+	if opts == nil {
+		return errors.New("options cannot be nil")
+	}
+
+	switch opts.Exporter {
+	case OTelExporterOTLP:
+		if opts.Endpoint == "" {
+			return errors.New("Endpoint cannot be empty when using otlp exporter")
+		}
+	case OTelExporterFile:
+		if opts.FilePath == "" {
+			return errors.New("FilePath cannot be empty when using file exporter")
+		}
+	case OTelExporterStdout:
+	default:
+		return fmt.Errorf("unknown exporter '%s'", opts.Exporter)
+	}
+
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return errors.New("SampleRatio must be between 0 and 1")
+	}
+
+	if opts.MetricInterval == 0 {
+		opts.MetricInterval = DefaultOTelMetricInterval
+	}
+
+	return nil
+}
+
+func (o *OTel) newExporters(ctx context.Context) (sdktrace.SpanExporter, sdkmetric.Exporter, error) {
+	switch o.options.Exporter {
+	case OTelExporterOTLP:
+		traceOpts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(o.options.Endpoint),
+			otlptracegrpc.WithHeaders(o.options.Headers),
+		}
+
+		metricOpts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(o.options.Endpoint),
+			otlpmetricgrpc.WithHeaders(o.options.Headers),
+		}
+
+		if o.options.Insecure {
+			traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+			metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+		}
+
+		spanExporter, err := otlptracegrpc.New(ctx, traceOpts...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to create otlp trace exporter")
+		}
+
+		metricExporter, err := otlpmetricgrpc.New(ctx, metricOpts...)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to create otlp metric exporter")
+		}
+
+		return spanExporter, metricExporter, nil
+	default:
+		var w io.Writer = os.Stdout
+
+		if o.options.Exporter == OTelExporterFile {
+			f, err := os.OpenFile(o.options.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "unable to open otel file '%s'", o.options.FilePath)
+			}
+
+			o.file = f
+			w = f
+		}
+
+		spanExporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			o.closeFile()
+			return nil, nil, errors.Wrap(err, "unable to create stdout trace exporter")
+		}
+
+		metricExporter, err := stdoutmetric.New(stdoutmetric.WithWriter(w))
+		if err != nil {
+			o.closeFile()
+			return nil, nil, errors.Wrap(err, "unable to create stdout metric exporter")
+		}
+
+		return spanExporter, metricExporter, nil
+	}
+}
+
+func (o *OTel) setupInstruments(meter metric.Meter) error {
+	var err error
+
+	o.httpRequests, err = meter.Int64Counter("http.server.request.count",
+		metric.WithDescription("Number of HTTP requests handled"))
+	if err != nil {
+		return errors.Wrap(err, "unable to create http request counter")
+	}
+
+	o.httpDuration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP requests"), metric.WithUnit("s"))
+	if err != nil {
+		return errors.Wrap(err, "unable to create http duration histogram")
+	}
+
+	o.txnCount, err = meter.Int64Counter("transaction.count",
+		metric.WithDescription("Number of transactions (ie. consumed messages) processed"))
+	if err != nil {
+		return errors.Wrap(err, "unable to create transaction counter")
+	}
+
+	o.txnDuration, err = meter.Float64Histogram("transaction.duration",
+		metric.WithDescription("Duration of transactions"), metric.WithUnit("s"))
+	if err != nil {
+		return errors.Wrap(err, "unable to create transaction duration histogram")
+	}
+
+	return nil
+}
+
+func (o *OTel) StartTransaction(ctx context.Context, name string, opts ...TransactionOption) (context.Context, ITransaction) {
+	to := newTransactionOptions(opts...)
+
+	kind := trace.SpanKindInternal
+
+	if len(to.headers) > 0 {
+		ctx = o.propagator.Extract(ctx, headerCarrier(to.headers))
+		kind = trace.SpanKindConsumer
+	}
+
+	ctx, span := o.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+
+	return ctx, &otelTransaction{
+		otel:    o,
+		span:    span,
+		name:    name,
+		started: time.Now(),
+	}
+}
+
+func (o *OTel) WrapHandler(method, route string, h http.Handler) http.Handler {
+	name := method + " " + route
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		ctx := o.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := o.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+
+		attrs := metric.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(rec.status),
+		)
+
+		o.httpRequests.Add(ctx, 1, attrs)
+		o.httpDuration.Record(ctx, time.Since(started).Seconds(), attrs)
+	})
+}
+
+// Shutdown flushes and shuts down both providers and closes the file (if
+// any); a failing step does not prevent the others
+func (o *OTel) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if err := o.tracerProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, errors.Wrap(err, "unable to shutdown tracer provider"))
+	}
+
+	if err := o.meterProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, errors.Wrap(err, "unable to shutdown meter provider"))
+	}
+
+	if err := o.closeFile(); err != nil {
+		errs = append(errs, errors.Wrap(err, "unable to close otel file"))
+	}
+
+	return stderrors.Join(errs...)
+}
+
+func (o *OTel) closeFile() error {
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.file.Close()
+	o.file = nil
+
+	return err
+}
+
+func (t *otelTransaction) SetAttribute(key string, value interface{}) {
+	var kv attribute.KeyValue
+
+	switch v := value.(type) {
+	case string:
+		kv = attribute.String(key, v)
+	case int:
+		kv = attribute.Int(key, v)
+	case int64:
+		kv = attribute.Int64(key, v)
+	case float64:
+		kv = attribute.Float64(key, v)
+	case bool:
+		kv = attribute.Bool(key, v)
+	default:
+		kv = attribute.String(key, fmt.Sprintf("%v", v))
+	}
+
+	t.span.SetAttributes(kv)
+}
+
+func (t *otelTransaction) NoticeError(err error) {
+	if err == nil {
+		return
+	}
+
+	t.failed = true
+
+	t.span.RecordError(err)
+	t.span.SetStatus(codes.Error, err.Error())
+}
+
+func (t *otelTransaction) End() {
+	t.span.End()
+
+	outcome := "ok"
+
+	if t.failed {
+		outcome = "error"
+	}
+
+	attrs := metric.WithAttributes(
+		attribute.String("transaction", t.name),
+		attribute.String("outcome", outcome),
+	)
+
+	t.otel.txnCount.Add(context.Background(), 1, attrs)
+	t.otel.txnDuration.Record(context.Background(), time.Since(t.started).Seconds(), attrs)
+}
+
+// headerCarrier adapts message headers (ie. amqp.Table) to a TextMapCarrier
+type headerCarrier map[string]interface{}
+
+func (h headerCarrier) Get(key string) string {
+	if v, ok := h[key].(string); ok {
+		return v
+	}
+
+	return ""
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+
+	for k := range h {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
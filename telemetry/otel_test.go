@@ -0,0 +1,161 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceParent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+var _ = Describe("OTel", func() {
+	var (
+		o    *OTel
+		dir  string
+		file string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = os.MkdirTemp("", "telemetry-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		file = filepath.Join(dir, "otel.json")
+
+		o, err = NewOTel(&OTelOptions{
+			ServiceName:    "go-svc-template",
+			ServiceVersion: "test",
+			EnvName:        "test",
+			Exporter:       OTelExporterFile,
+			FilePath:       file,
+			SampleRatio:    1,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		// Shutting down twice only returns an error, nothing to clean up
+		_ = o.Shutdown(context.Background())
+
+		os.RemoveAll(dir)
+	})
+
+	Context("file exporter", func() {
+		It("should write spans and metrics on shutdown", func() {
+			_, txn := o.StartTransaction(context.Background(), "consume main")
+			txn.SetAttribute("queue", "main")
+			txn.NoticeError(errors.New("boom"))
+			txn.End()
+
+			h := o.WrapHandler(http.MethodGet, "/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			// Nothing is written before the batcher/reader flush
+			Expect(o.Shutdown(context.Background())).To(Succeed())
+
+			data, err := os.ReadFile(file)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(data)).To(ContainSubstring(`"Name":"consume main"`))
+			Expect(string(data)).To(ContainSubstring(`"Name":"GET /health"`))
+			Expect(string(data)).To(ContainSubstring("boom"))
+			Expect(string(data)).To(ContainSubstring("transaction.count"))
+			Expect(string(data)).To(ContainSubstring("http.server.request.count"))
+		})
+	})
+
+	It("should attempt every shutdown step even if one fails", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Both providers fail to flush with a cancelled ctx
+		err := o.Shutdown(ctx)
+		Expect(err).To(MatchError(ContainSubstring("unable to shutdown tracer provider")))
+		Expect(err).To(MatchError(ContainSubstring("unable to shutdown meter provider")))
+		Expect(o.file).To(BeNil())
+	})
+
+	Context("header propagation", func() {
+		It("should continue the trace from message headers", func() {
+			ctx, txn := o.StartTransaction(context.Background(), "consume main",
+				WithHeaders(map[string]interface{}{"traceparent": testTraceParent}))
+			defer txn.End()
+
+			sc := trace.SpanContextFromContext(ctx)
+
+			Expect(sc.TraceID().String()).To(Equal(testTraceID))
+			Expect(sc.IsSampled()).To(BeTrue())
+		})
+
+		It("should start a new trace without headers", func() {
+			ctx, txn := o.StartTransaction(context.Background(), "consume main")
+			defer txn.End()
+
+			sc := trace.SpanContextFromContext(ctx)
+
+			Expect(sc.IsValid()).To(BeTrue())
+			Expect(sc.TraceID().String()).ToNot(Equal(testTraceID))
+		})
+
+		It("should continue the trace from request headers", func() {
+			var traceID string
+
+			h := o.WrapHandler(http.MethodGet, "/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceID = trace.SpanContextFromContext(r.Context()).TraceID().String()
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set("traceparent", testTraceParent)
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			Expect(traceID).To(Equal(testTraceID))
+		})
+	})
+})
+
+var _ = Describe("headerCarrier", func() {
+	It("should only return string values", func() {
+		c := headerCarrier{"traceparent": testTraceParent, "retries": 3}
+
+		Expect(c.Get("traceparent")).To(Equal(testTraceParent))
+		Expect(c.Get("retries")).To(BeEmpty())
+		Expect(c.Get("missing")).To(BeEmpty())
+
+		c.Set("tracestate", "vendor=1")
+
+		Expect(c.Get("tracestate")).To(Equal("vendor=1"))
+		Expect(c.Keys()).To(ConsistOf("traceparent", "retries", "tracestate"))
+	})
+})
+
+var _ = Describe("validateOTelOptions", func() {
+	It("should reject invalid options", func() {
+		Expect(validateOTelOptions(nil)).ToNot(Succeed())
+		Expect(validateOTelOptions(&OTelOptions{Exporter: "zipkin"})).To(MatchError(ContainSubstring("unknown exporter")))
+		Expect(validateOTelOptions(&OTelOptions{Exporter: OTelExporterOTLP})).To(MatchError(ContainSubstring("Endpoint")))
+		Expect(validateOTelOptions(&OTelOptions{Exporter: OTelExporterFile})).To(MatchError(ContainSubstring("FilePath")))
+		Expect(validateOTelOptions(&OTelOptions{Exporter: OTelExporterStdout, SampleRatio: 1.5})).To(MatchError(ContainSubstring("SampleRatio")))
+	})
+
+	It("should default the metric interval", func() {
+		opts := &OTelOptions{Exporter: OTelExporterStdout}
+
+		Expect(validateOTelOptions(opts)).To(Succeed())
+		Expect(opts.MetricInterval).To(Equal(DefaultOTelMetricInterval))
+	})
+})
@@ -0,0 +1,90 @@
+// Package telemetry is a thin, vendor-neutral abstraction for tracing and
+// metrics. Services and the API should only ever talk to ITelemetry - the
+// actual provider (New Relic, OpenTelemetry or noop) is picked in deps.
+package telemetry
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	ProviderNone     = "none"
+	ProviderNewRelic = "newrelic"
+	ProviderOTel     = "otel"
+)
+
+type ITelemetry interface {
+	// StartTransaction starts a new unit of work (ie. processing a single
+	// consumed message). The returned context carries the transaction and
+	// should be passed to anything that wants to add child spans.
+	StartTransaction(ctx context.Context, name string, opts ...TransactionOption) (context.Context, ITransaction)
+
+	// WrapHandler instruments an HTTP handler; route should be the route
+	// pattern (not the actual path) to keep cardinality low.
+	WrapHandler(method, route string, h http.Handler) http.Handler
+
+	// Shutdown flushes any buffered telemetry and releases exporters
+	Shutdown(ctx context.Context) error
+}
+
+type ITransaction interface {
+	SetAttribute(key string, value interface{})
+	NoticeError(err error)
+	End()
+}
+
+type TransactionOption func(o *transactionOptions)
+
+type transactionOptions struct {
+	headers map[string]interface{}
+}
+
+// WithHeaders passes message headers (ie. amqp.Table) to the transaction so
+// that an upstream trace context can be picked up.
+func WithHeaders(headers map[string]interface{}) TransactionOption {
+	return func(o *transactionOptions) {
+		o.headers = headers
+	}
+}
+
+func newTransactionOptions(opts ...TransactionOption) *transactionOptions {
+	o := &transactionOptions{}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// statusRecorder captures the status code written by a wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush is needed for handlers that stream (pprof, SSE)
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,354 @@
+// Package tlscert builds server TLS configs from cert/key files and reloads
+// them whenever the files change (ie. when cert-manager rotates a secret) so
+// that a restart is not needed.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/streamdal/go-svc-template/clog"
+)
+
+const (
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+
+	CipherPolicyDefault = "default"
+	CipherPolicyModern  = "modern"
+
+	// reloadDebounce groups the burst of events caused by a single rotation
+	reloadDebounce = time.Second
+)
+
+// modernCipherSuites are the TLS 1.2 suites with forward secrecy and AEAD;
+// TLS 1.3 suites are not configurable in Go.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+type Options struct {
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile enables verification of client certificates (mTLS)
+	ClientCAFile string
+
+	// ClientAuth is either "optional" (verify if given) or "require"
+	ClientAuth string
+
+	// MinVersion is either "1.2" or "1.3"
+	MinVersion string
+
+	// CipherPolicy is either "default" (Go's defaults) or "modern"; ignored
+	// if CipherSuites is set
+	CipherPolicy string
+
+	// CipherSuites is an explicit list of TLS 1.2 cipher suite names
+	CipherSuites []string
+
+	// OnReload is called with the new certificate's expiry after every
+	// successful (re)load
+	OnReload func(notAfter time.Time)
+
+	Log clog.ICustomLog
+}
+
+type Reloader struct {
+	options    *Options
+	base       *tls.Config
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	notAfter   time.Time
+	lastReload time.Time
+	mtx        *sync.RWMutex
+	log        clog.ICustomLog
+}
+
+// New loads the certificate (and client CA, if set) and returns a Reloader.
+// Call Watch() to reload on file changes.
+func New(opts *Options) (*Reloader, error) {
+	if err := validateOptions(opts); err != nil {
+		return nil, errors.Wrap(err, "unable to validate options")
+	}
+
+	base, err := baseConfig(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build TLS config")
+	}
+
+	r := &Reloader{
+		options: opts,
+		base:    base,
+		mtx:     &sync.RWMutex{},
+		log:     opts.Log.With(zap.String("pkg", "tlscert")),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func validateOptions(opts *Options) error {
+	if opts == nil {
+		return errors.New("options cannot be nil")
+	}
+
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return errors.New("CertFile and KeyFile must be set")
+	}
+
+	if opts.Log == nil {
+		opts.Log = &clog.CustomLogNoop{}
+	}
+
+	return nil
+}
+
+func baseConfig(opts *Options) (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	switch opts.MinVersion {
+	case "", "1.2":
+		cfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported min version '%s'", opts.MinVersion)
+	}
+
+	switch {
+	case len(opts.CipherSuites) > 0:
+		suites, err := cipherSuiteIDs(opts.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.CipherSuites = suites
+	case opts.CipherPolicy == CipherPolicyModern:
+		cfg.CipherSuites = modernCipherSuites
+	case opts.CipherPolicy == "" || opts.CipherPolicy == CipherPolicyDefault:
+	default:
+		return nil, fmt.Errorf("unknown cipher policy '%s'", opts.CipherPolicy)
+	}
+
+	if opts.ClientCAFile != "" {
+		switch opts.ClientAuth {
+		case "", ClientAuthOptional:
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		case ClientAuthRequire:
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("unknown client auth mode '%s'", opts.ClientAuth)
+		}
+	}
+
+	return cfg, nil
+}
+
+// cipherSuiteIDs maps cipher suite names to IDs; only suites that Go
+// considers secure are accepted
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// TLSConfig returns a config for http.Server; the certificate and client CAs
+// are looked up on every handshake so reloads take effect immediately.
+func (r *Reloader) TLSConfig() *tls.Config {
+	cfg := r.base.Clone()
+	cfg.GetCertificate = r.getCertificate
+
+	if r.options.ClientCAFile != "" {
+		cfg.GetConfigForClient = func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			c := r.base.Clone()
+			c.GetCertificate = r.getCertificate
+
+			// Set by http2.ConfigureServer after TLSConfig() returns
+			c.NextProtos = cfg.NextProtos
+
+			r.mtx.RLock()
+			c.ClientCAs = r.clientCAs
+			r.mtx.RUnlock()
+
+			return c, nil
+		}
+	}
+
+	return cfg
+}
+
+func (r *Reloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.cert, nil
+}
+
+// NotAfter returns the expiry of the currently served certificate
+func (r *Reloader) NotAfter() time.Time {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.notAfter
+}
+
+// LastReload returns when the certificate was last (re)loaded
+func (r *Reloader) LastReload() time.Time {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.lastReload
+}
+
+// Reload re-reads the certificate, key and client CA. On error, the previous
+// certificate keeps being served.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.options.CertFile, r.options.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to load key pair")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "unable to parse certificate")
+	}
+
+	cert.Leaf = leaf
+
+	var pool *x509.CertPool
+
+	if r.options.ClientCAFile != "" {
+		data, err := os.ReadFile(r.options.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to read client CA file")
+		}
+
+		pool = x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("client CA file does not contain any PEM certificates")
+		}
+	}
+
+	r.mtx.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.notAfter = leaf.NotAfter
+	r.lastReload = time.Now()
+	r.mtx.Unlock()
+
+	if r.options.OnReload != nil {
+		r.options.OnReload(leaf.NotAfter)
+	}
+
+	return nil
+}
+
+// Watch reloads the certificate whenever the cert, key or client CA files
+// change, until ctx is cancelled. The parent directories are watched since
+// K8S secret volumes are updated by swapping a symlink.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "unable to create file watcher")
+	}
+
+	dirs := map[string]struct{}{
+		filepath.Dir(r.options.CertFile): {},
+		filepath.Dir(r.options.KeyFile):  {},
+	}
+
+	if r.options.ClientCAFile != "" {
+		dirs[filepath.Dir(r.options.ClientCAFile)] = struct{}{}
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return errors.Wrapf(err, "unable to watch '%s'", dir)
+		}
+	}
+
+	go r.watch(ctx, watcher)
+
+	return nil
+}
+
+func (r *Reloader) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	logger := r.log.With(zap.String("method", "watch"))
+
+	defer watcher.Close()
+
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+
+			debounce = time.After(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			logger.Warn("file watcher error", zap.Error(err))
+		case <-debounce:
+			debounce = nil
+
+			if err := r.Reload(); err != nil {
+				logger.Error("unable to reload certificate; keeping previous one",
+					zap.String("certFile", r.options.CertFile), zap.Error(err))
+
+				continue
+			}
+
+			logger.Info("reloaded certificate",
+				zap.String("certFile", r.options.CertFile),
+				zap.Time("notAfter", r.NotAfter()),
+			)
+		}
+	}
+}
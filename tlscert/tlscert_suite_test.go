@@ -0,0 +1,13 @@
+package tlscert
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTLSCertSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TLSCert Suite")
+}
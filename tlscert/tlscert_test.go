@@ -0,0 +1,159 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reloader", func() {
+	var (
+		dir      string
+		certFile string
+		keyFile  string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = os.MkdirTemp("", "tlscert")
+		Expect(err).ToNot(HaveOccurred())
+
+		certFile = filepath.Join(dir, "tls.crt")
+		keyFile = filepath.Join(dir, "tls.key")
+
+		writeCert(certFile, keyFile, time.Now().Add(time.Hour))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("New", func() {
+		It("should load the certificate and report its expiry", func() {
+			var reported time.Time
+
+			r, err := New(&Options{
+				CertFile: certFile,
+				KeyFile:  keyFile,
+				OnReload: func(notAfter time.Time) { reported = notAfter },
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.NotAfter()).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			Expect(reported).To(Equal(r.NotAfter()))
+
+			cert, err := r.TLSConfig().GetCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert).ToNot(BeNil())
+		})
+
+		It("should apply min version and cipher policy", func() {
+			r, err := New(&Options{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				MinVersion:   "1.3",
+				CipherPolicy: CipherPolicyModern,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg := r.TLSConfig()
+			Expect(cfg.MinVersion).To(Equal(uint16(tls.VersionTLS13)))
+			Expect(cfg.CipherSuites).To(Equal(modernCipherSuites))
+		})
+
+		It("should reject unknown cipher suites", func() {
+			_, err := New(&Options{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should require client certs when configured", func() {
+			r, err := New(&Options{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				ClientCAFile: certFile,
+				ClientAuth:   ClientAuthRequire,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			cfg, err := r.TLSConfig().GetConfigForClient(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cfg.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+			Expect(cfg.ClientCAs).ToNot(BeNil())
+		})
+
+		It("should error if the files do not exist", func() {
+			_, err := New(&Options{CertFile: "/does/not/exist", KeyFile: keyFile})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Watch", func() {
+		It("should reload the certificate when the files change", func() {
+			r, err := New(&Options{CertFile: certFile, KeyFile: keyFile})
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			Expect(r.Watch(ctx)).To(Succeed())
+
+			writeCert(certFile, keyFile, time.Now().Add(48*time.Hour))
+
+			Eventually(r.NotAfter, 5*time.Second, 100*time.Millisecond).Should(
+				BeTemporally("~", time.Now().Add(48*time.Hour), time.Minute))
+		})
+
+		It("should keep serving the previous certificate if the new one is invalid", func() {
+			r, err := New(&Options{CertFile: certFile, KeyFile: keyFile})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.WriteFile(certFile, []byte("garbage"), 0600)).To(Succeed())
+			Expect(r.Reload()).ToNot(Succeed())
+
+			Expect(r.NotAfter()).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		})
+	})
+})
+
+// writeCert writes a self-signed certificate + key that expires at notAfter
+func writeCert(certFile, keyFile string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+}